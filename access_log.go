@@ -0,0 +1,212 @@
+package lmdrouter
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// DefaultRedactedHeaders are the request headers whose values are redacted by
+// AccessLogMiddleware if no other headers are provided.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+}
+
+// AccessLogOptions modify the behavior of AccessLogMiddleware.
+type AccessLogOptions struct {
+	// Logger is the logger records are written to. If nil, slog.Default() is
+	// used.
+	Logger *slog.Logger
+
+	// SampleRate is the fraction of successful requests (i.e. those whose
+	// response has a status code lower than 400) that are logged, between 0
+	// and 1. Failed requests are always logged. If zero, all requests are
+	// logged.
+	SampleRate float64
+
+	// Headers causes the request headers to be included in records, in a
+	// group named "headers".
+	Headers bool
+
+	// RedactHeaders are the names of request headers whose values are
+	// replaced with "REDACTED" in records. If nil, DefaultRedactedHeaders is
+	// used.
+	RedactHeaders []string
+
+	// ContextLogger causes a request-scoped logger to be stored in the
+	// request's context, which handlers can retrieve with LoggerFromContext.
+	// The logger includes the method, route, path and request IDs of the
+	// request in its records.
+	ContextLogger bool
+}
+
+type loggerKey struct{}
+
+// LoggerFromContext returns the request-scoped logger stored in a context by
+// AccessLogMiddleware. If there is none, slog.Default() is returned.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// AccessLogMiddleware returns a middleware that writes an access log record
+// for every request, through a structured log/slog logger. Records include
+// the method, route pattern (see RouteFromContext), path, status code,
+// latency, request ID, Lambda request ID, source IP, user agent and response
+// size of every request. The request ID is taken from RequestIDMiddleware if
+// it precedes this middleware, and from the API Gateway request context
+// otherwise. Records of successful requests are written with the Info level,
+// those of client errors with the Warn level, and those of server errors with
+// the Error level.
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter(
+//         "/api",
+//         lmdrouter.AccessLogMiddleware(lmdrouter.AccessLogOptions{
+//             Logger:        slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+//             ContextLogger: true,
+//         }),
+//     )
+//
+func AccessLogMiddleware(opts AccessLogOptions) Middleware {
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultRedactedHeaders
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			start := time.Now()
+
+			logger := opts.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+
+			route := ""
+			if info, ok := RouteFromContext(ctx); ok {
+				route = info.Pattern
+			}
+
+			requestID, ok := RequestIDFromContext(ctx)
+			if !ok {
+				requestID = req.RequestContext.RequestID
+			}
+
+			requestAttrs := []interface{}{
+				slog.String("method", req.HTTPMethod),
+				slog.String("route", route),
+				slog.String("path", req.Path),
+				slog.String("request_id", requestID),
+			}
+			if lc, ok := lambdacontext.FromContext(ctx); ok {
+				requestAttrs = append(
+					requestAttrs,
+					slog.String("lambda_request_id", lc.AwsRequestID),
+				)
+			}
+
+			if opts.ContextLogger {
+				ctx = context.WithValue(ctx, loggerKey{}, logger.With(requestAttrs...))
+			}
+
+			res, err = next(ctx, req)
+
+			status := res.StatusCode
+			if err != nil {
+				status = http.StatusInternalServerError
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+
+			if level == slog.LevelInfo && opts.SampleRate > 0 &&
+				rand.Float64() >= opts.SampleRate {
+				return res, err
+			}
+
+			if !logger.Enabled(ctx, level) {
+				return res, err
+			}
+
+			userAgent := req.RequestContext.Identity.UserAgent
+			if userAgent == "" {
+				userAgent = headerValue(req.Headers, "User-Agent")
+			}
+
+			attrs := append(
+				requestAttrs,
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("source_ip", req.RequestContext.Identity.SourceIP),
+				slog.String("user_agent", userAgent),
+				slog.Int("size", responseSize(res)),
+			)
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			if opts.Headers {
+				attrs = append(attrs, redactedHeaders(req.Headers, opts.RedactHeaders))
+			}
+
+			logger.Log(ctx, level, "request", attrs...)
+
+			return res, err
+		}
+	}
+}
+
+// responseSize returns the size of a response body in bytes, after base-64
+// decoding if necessary.
+func responseSize(res events.APIGatewayProxyResponse) int {
+	if !res.IsBase64Encoded {
+		return len(res.Body)
+	}
+
+	size := len(res.Body) / 4 * 3
+	switch {
+	case strings.HasSuffix(res.Body, "=="):
+		size -= 2
+	case strings.HasSuffix(res.Body, "="):
+		size--
+	}
+
+	return size
+}
+
+// redactedHeaders returns an attribute group with the headers of a request,
+// where the values of the provided headers are redacted.
+func redactedHeaders(headers map[string]string, redact []string) slog.Attr {
+	attrs := make([]interface{}, 0, len(headers))
+	for key, value := range headers {
+		for _, name := range redact {
+			if strings.EqualFold(key, name) {
+				value = "REDACTED"
+				break
+			}
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+
+	return slog.Group("headers", attrs...)
+}
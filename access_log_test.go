@@ -0,0 +1,134 @@
+package lmdrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	lmd := NewRouter("/api", AccessLogMiddleware(AccessLogOptions{
+		Logger:        logger,
+		Headers:       true,
+		ContextLogger: true,
+	}))
+	lmd.Route("GET", "/:id", func(ctx context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		LoggerFromContext(ctx).Info("fetching item", "id", req.PathParameters["id"])
+		if req.PathParameters["id"] == "missing" {
+			return HandleError(HTTPError{http.StatusNotFound, "No such item"})
+		}
+		return MarshalResponse(http.StatusOK, nil, req.PathParameters)
+	})
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID: "lambda-req-1",
+	})
+
+	records := func() []map[string]interface{} {
+		var list []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]interface{}
+			err := json.Unmarshal([]byte(line), &record)
+			assert.Equal(t, nil, err, "Record must be valid JSON")
+			list = append(list, record)
+		}
+		buf.Reset()
+		return list
+	}
+
+	_, err := lmd.Handler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/api/bla",
+		Headers: map[string]string{
+			"authorization": "Bearer secret-token",
+			"User-Agent":    "test-client/1.0",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "apigw-req-1",
+			Identity:  events.APIGatewayRequestIdentity{SourceIP: "10.0.0.1"},
+		},
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+
+	list := records()
+	assert.Equal(t, 2, len(list), "Two records must be written")
+
+	handlerRecord := list[0]
+	assert.Equal(t, "fetching item", handlerRecord["msg"], "Handler record must be first")
+	assert.Equal(t, "/api/:id", handlerRecord["route"], "Context logger must include route")
+	assert.Equal(t, "lambda-req-1", handlerRecord["lambda_request_id"], "Context logger must include Lambda request ID")
+
+	record := list[1]
+	assert.Equal(t, "request", record["msg"], "Message must be correct")
+	assert.Equal(t, "INFO", record["level"], "Level must be correct")
+	assert.Equal(t, "GET", record["method"], "Method must be logged")
+	assert.Equal(t, "/api/:id", record["route"], "Route must be logged")
+	assert.Equal(t, "/api/bla", record["path"], "Path must be logged")
+	assert.Equal(t, float64(200), record["status"], "Status must be logged")
+	assert.Equal(t, "apigw-req-1", record["request_id"], "Request ID must be logged")
+	assert.Equal(t, "lambda-req-1", record["lambda_request_id"], "Lambda request ID must be logged")
+	assert.Equal(t, "10.0.0.1", record["source_ip"], "Source IP must be logged")
+	assert.Equal(t, "test-client/1.0", record["user_agent"], "User agent must be logged")
+	assert.Equal(t, float64(len(`{"id":"bla"}`)), record["size"], "Size must be logged")
+	_, ok := record["latency"]
+	assert.True(t, ok, "Latency must be logged")
+
+	headers, _ := record["headers"].(map[string]interface{})
+	assert.Equal(t, "REDACTED", headers["authorization"], "Authorization header must be redacted")
+	assert.Equal(t, "test-client/1.0", headers["User-Agent"], "Other headers must be logged")
+
+	_, err = lmd.Handler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/api/missing",
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+	list = records()
+	assert.Equal(t, "WARN", list[len(list)-1]["level"], "Client errors must be logged as warnings")
+	assert.Equal(t, float64(404), list[len(list)-1]["status"], "Status must be logged")
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	handler := AccessLogMiddleware(AccessLogOptions{
+		Logger:     slog.New(slog.NewTextHandler(&buf, nil)),
+		SampleRate: 0.000001,
+	})(func(_ context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		if req.Path == "/fail" {
+			return HandleError(HTTPError{http.StatusBadRequest, "Bad request"})
+		}
+		return MarshalResponse(http.StatusOK, nil, nil)
+	})
+
+	for i := 0; i < 10; i++ {
+		handler(context.Background(), events.APIGatewayProxyRequest{Path: "/ok"})   // nolint: errcheck
+		handler(context.Background(), events.APIGatewayProxyRequest{Path: "/fail"}) // nolint: errcheck
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 10, len(lines), "Only failed requests must be logged")
+	assert.True(t, strings.Contains(lines[0], "status=400"), "Failed request must be logged")
+}
+
+func TestResponseSize(t *testing.T) {
+	for _, body := range []string{"", "a", "ab", "abc", "abcd"} {
+		res, _ := Binary(http.StatusOK, "application/octet-stream", []byte(body))
+		assert.Equal(t, len(body), responseSize(res), "Size must be correct for "+body)
+	}
+}
@@ -0,0 +1,137 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// APIKey describes the owner of an API key, as stored in an APIKeyStore.
+type APIKey struct {
+	// ID identifies the owner of the key (e.g. a partner's ID). It should not
+	// be the key itself.
+	ID string
+
+	// Scopes are the scopes granted to the key.
+	Scopes []string
+}
+
+// APIKeyStore is an interface for looking up API keys. Keys are looked up by
+// their hash (see HashAPIKey), so that stores never have to hold, and
+// requests never have to be compared with, raw keys.
+type APIKeyStore interface {
+	// LookupAPIKey returns the key with the provided hash. It returns false
+	// if the key is unknown (or revoked), and a non-nil error if the lookup
+	// failed.
+	LookupAPIKey(ctx context.Context, hash string) (key APIKey, ok bool, err error)
+}
+
+// StaticAPIKeys is an APIKeyStore backed by a map of key hashes (see
+// HashAPIKey) to keys, which is useful for a small number of keys provided via
+// configuration.
+type StaticAPIKeys map[string]APIKey
+
+// LookupAPIKey implements the APIKeyStore interface.
+func (keys StaticAPIKeys) LookupAPIKey(_ context.Context, hash string) (
+	APIKey,
+	bool,
+	error,
+) {
+	key, ok := keys[hash]
+	return key, ok, nil
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash of a raw API key, which is
+// how keys are provided to APIKeyStore implementations. API keys should be
+// long, randomly generated strings, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyOptions modify the behavior of APIKeyMiddleware.
+type APIKeyOptions struct {
+	// Store is used to look up keys. It is required.
+	Store APIKeyStore
+
+	// Header is the name of the header that contains the key. If empty,
+	// "X-Api-Key" is used.
+	Header string
+
+	// QueryParam is the name of a query string parameter that may contain
+	// the key, for clients that cannot send custom headers. If empty, keys
+	// are only accepted in the header.
+	QueryParam string
+}
+
+type apiKeyKey struct{}
+
+// APIKeyFromContext returns the API key of the request with the provided
+// context, if it was authenticated by APIKeyMiddleware.
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(APIKey)
+	return key, ok
+}
+
+// APIKeyMiddleware returns a middleware that authenticates requests with API
+// keys, taken from a header or a query string parameter, and looked up in a
+// store by their hash. Requests without a key are rejected with a 401
+// Unauthorized error response, and requests with an unknown key are rejected
+// with a 403 Forbidden error response, both generated by the router's error
+// handler. If the lookup fails, a 500 Internal Server Error response is
+// generated. The key of authenticated requests is stored in the request's
+// context, and can be retrieved with APIKeyFromContext. The key's ID and
+// scopes are also stored as the request's Principal.
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter("/partners", lmdrouter.APIKeyMiddleware(
+//         lmdrouter.APIKeyOptions{
+//             Store: lmdrouter.StaticAPIKeys{
+//                 os.Getenv("ACME_KEY_HASH"): {ID: "acme", Scopes: []string{"orders:read"}},
+//             },
+//         },
+//     ))
+//
+func APIKeyMiddleware(opts APIKeyOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "X-Api-Key"
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			raw := headerValue(req.Headers, opts.Header)
+			if raw == "" && opts.QueryParam != "" {
+				raw = req.QueryStringParameters[opts.QueryParam]
+			}
+
+			if raw == "" {
+				return routerFromContext(ctx).handleError(HTTPError{
+					Code:    http.StatusUnauthorized,
+					Message: "missing API key",
+				})
+			}
+
+			key, ok, err := opts.Store.LookupAPIKey(ctx, HashAPIKey(raw))
+			if err != nil {
+				return routerFromContext(ctx).handleError(err)
+			}
+			if !ok {
+				return routerFromContext(ctx).handleError(HTTPError{
+					Code:    http.StatusForbidden,
+					Message: "invalid API key",
+				})
+			}
+
+			ctx = context.WithValue(ctx, apiKeyKey{}, key)
+			ctx = WithPrincipal(ctx, Principal{ID: key.ID, Scopes: key.Scopes})
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lmdrouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+type failingKeyStore struct{}
+
+func (failingKeyStore) LookupAPIKey(_ context.Context, _ string) (APIKey, bool, error) {
+	return APIKey{}, false, errors.New("table not found")
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	store := StaticAPIKeys{
+		HashAPIKey("partner-key"): {ID: "acme", Scopes: []string{"orders:read"}},
+	}
+
+	whoami := func(ctx context.Context, _ events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		key, _ := APIKeyFromContext(ctx)
+		return MarshalResponse(http.StatusOK, nil, map[string]string{
+			"id":     key.ID,
+			"scopes": strings.Join(key.Scopes, " "),
+		})
+	}
+
+	lmd := NewRouter("/api")
+	lmd.Route("GET", "/header", whoami, APIKeyMiddleware(APIKeyOptions{Store: store}))
+	lmd.Route("GET", "/query", whoami, APIKeyMiddleware(APIKeyOptions{
+		Store:      store,
+		Header:     "X-Partner-Key",
+		QueryParam: "api_key",
+	}))
+	lmd.Route("GET", "/failing", whoami, APIKeyMiddleware(APIKeyOptions{Store: failingKeyStore{}}))
+
+	for name, test := range map[string]struct {
+		path    string
+		headers map[string]string
+		query   map[string]string
+		status  int
+	}{
+		"valid header key":        {"/api/header", map[string]string{"x-api-key": "partner-key"}, nil, http.StatusOK},
+		"valid custom header key": {"/api/query", map[string]string{"X-Partner-Key": "partner-key"}, nil, http.StatusOK},
+		"valid query key":         {"/api/query", nil, map[string]string{"api_key": "partner-key"}, http.StatusOK},
+		"missing key":             {"/api/header", nil, nil, http.StatusUnauthorized},
+		"query key not allowed":   {"/api/header", nil, map[string]string{"api_key": "partner-key"}, http.StatusUnauthorized},
+		"invalid key":             {"/api/header", map[string]string{"X-Api-Key": "other-key"}, nil, http.StatusForbidden},
+		"hash instead of key":     {"/api/header", map[string]string{"X-Api-Key": HashAPIKey("partner-key")}, nil, http.StatusForbidden},
+		"failing store":           {"/api/failing", map[string]string{"X-Api-Key": "partner-key"}, nil, http.StatusInternalServerError},
+	} {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod:            "GET",
+			Path:                  test.path,
+			Headers:               test.headers,
+			QueryStringParameters: test.query,
+		})
+		assert.Equal(t, nil, err, "Error must be nil for "+name)
+		assert.Equal(t, test.status, res.StatusCode, "Status code must be correct for "+name)
+		if test.status == http.StatusOK {
+			assert.Equal(t, `{"id":"acme","scopes":"orders:read"}`, res.Body, "Key must be stored in context for "+name)
+		}
+	}
+}
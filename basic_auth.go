@@ -1,6 +1,9 @@
 package lmdrouter
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"strings"
 
@@ -10,8 +13,9 @@ import (
 // BasicAuth attempts to parse a username and password from the request's
 // "Authorization" header. If the Authorization header is missing, or does not
 // contain valid Basic HTTP Authentication date, empty values will be returned.
+// The header is looked up in a case-insensitive way.
 func BasicAuth(req events.APIGatewayProxyRequest) (user, pass string) {
-	auth := req.Headers["Authorization"]
+	auth := headerValue(req.Headers, "Authorization")
 	if auth == "" {
 		return user, pass
 	}
@@ -34,3 +38,88 @@ func BasicAuth(req events.APIGatewayProxyRequest) (user, pass string) {
 
 	return cs[:s], cs[s+1:]
 }
+
+// BasicAuthValidator is a function that checks the credentials of a request
+// authenticated with Basic HTTP Authentication. It returns true if the
+// credentials are valid, and a non-nil error if they could not be checked
+// (e.g. because a database could not be reached).
+type BasicAuthValidator func(ctx context.Context, user, pass string) (bool, error)
+
+// StaticCredentials returns a BasicAuthValidator that checks credentials
+// against a map of usernames to passwords. Comparisons are performed in
+// constant time, so that the validity of usernames and passwords cannot be
+// inferred from response times.
+func StaticCredentials(users map[string]string) BasicAuthValidator {
+	hashed := make(map[string][sha256.Size]byte, len(users))
+	for user, pass := range users {
+		hashed[user] = sha256.Sum256([]byte(pass))
+	}
+
+	return func(_ context.Context, user, pass string) (bool, error) {
+		// unknown users are compared against a zero hash, so that they take
+		// as long as known ones
+		expected, ok := hashed[user]
+		actual := sha256.Sum256([]byte(pass))
+		match := subtle.ConstantTimeCompare(actual[:], expected[:]) == 1
+
+		return ok && match, nil
+	}
+}
+
+type basicAuthUserKey struct{}
+
+// BasicAuthUser returns the username of the request with the provided
+// context, if it was authenticated by BasicAuthMiddleware.
+func BasicAuthUser(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(basicAuthUserKey{}).(string)
+	return user, ok
+}
+
+// BasicAuthMiddleware returns a middleware that authenticates requests with
+// Basic HTTP Authentication. The credentials are parsed with BasicAuth and
+// checked with the provided validator (e.g. StaticCredentials). Requests
+// without valid credentials are rejected with a 401 Unauthorized error
+// response, generated by the router's error handler, with a
+// "WWW-Authenticate" challenge for the provided realm. If the validator
+// fails, a 500 Internal Server Error response is generated. The username of
+// authenticated requests is stored in the request's context, and can be
+// retrieved with BasicAuthUser or as the ID of the request's Principal.
+//
+// Example:
+//
+//     router.Route("GET", "/admin/stats", getStats, lmdrouter.BasicAuthMiddleware(
+//         "admin",
+//         lmdrouter.StaticCredentials(map[string]string{
+//             "admin": os.Getenv("ADMIN_PASSWORD"),
+//         }),
+//     ))
+//
+func BasicAuthMiddleware(realm string, validator BasicAuthValidator) Middleware {
+	challenge := `Basic realm="` +
+		strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(realm) +
+		`", charset="UTF-8"`
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			user, pass := BasicAuth(req)
+			if user == "" && pass == "" {
+				return unauthorized(ctx, challenge, "missing credentials")
+			}
+
+			ok, err := validator(ctx, user, pass)
+			if err != nil {
+				return routerFromContext(ctx).handleError(err)
+			}
+			if !ok {
+				return unauthorized(ctx, challenge, "invalid credentials")
+			}
+
+			ctx = context.WithValue(ctx, basicAuthUserKey{}, user)
+			ctx = WithPrincipal(ctx, Principal{ID: user})
+			return next(ctx, req)
+		}
+	}
+}
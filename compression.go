@@ -0,0 +1,358 @@
+package lmdrouter
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Compressor is a content coding supported by CompressionMiddleware. Encoding
+// is the name of the coding, as used in the "Accept-Encoding" and
+// "Content-Encoding" headers (e.g. "gzip"), and NewWriter creates a writer
+// that compresses data written to it into w.
+type Compressor struct {
+	Encoding  string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// DefaultCompressors are the content codings used by CompressionMiddleware if
+// none are provided, in order of preference: brotli, gzip and deflate.
+var DefaultCompressors = []Compressor{
+	{
+		Encoding: "br",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return brotli.NewWriter(w), nil
+		},
+	},
+	{
+		Encoding: "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	},
+	{
+		Encoding: "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			// the "deflate" coding is zlib-wrapped (RFC 9110, section 8.4.1.2)
+			return zlib.NewWriterLevel(w, zlib.DefaultCompression)
+		},
+	},
+}
+
+// CompressionOptions modify the behavior of CompressionMiddleware.
+type CompressionOptions struct {
+	// MinSize is the minimum size of a response body, in bytes, for it to be
+	// compressed. If zero, 1024 is used.
+	MinSize int
+
+	// Compressors are the supported content codings, in order of preference.
+	// If empty, DefaultCompressors is used.
+	Compressors []Compressor
+}
+
+// compressedTypes are media types (or media type prefixes, if ending with a
+// slash) of content that is already compressed, and is therefore not worth
+// compressing again.
+var compressedTypes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/zstd",
+	"application/pdf",
+	"application/msgpack",
+}
+
+// CompressionMiddleware returns a middleware that compresses response bodies
+// according to the request's "Accept-Encoding" header, in order to reduce
+// payload sizes. The coding with the highest quality value is used, with
+// ties broken by the order of the compressors. Compressed bodies are base-64
+// encoded, and the "Content-Encoding" and "Vary" headers of the response are
+// set accordingly. Note that API Gateway REST APIs only decode base-64
+// encoded responses for content types listed in the API's binary media types
+// (e.g. "*/*").
+//
+// Responses are left untouched if the client does not accept any of the
+// supported codings, if their status code is not a success status code (e.g.
+// error responses generated by HandleError), if their body is smaller than
+// the minimum size, if they already have a "Content-Encoding" header, or if
+// their content type is one of already-compressed content (e.g. images, ZIP
+// archives and PDF documents). Responses are also left untouched if
+// compression does not make them smaller, and if they are streamed (see
+// StreamResponse).
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter(
+//         "/api",
+//         lmdrouter.CompressionMiddleware(lmdrouter.CompressionOptions{}),
+//     )
+//
+func CompressionMiddleware(opts CompressionOptions) Middleware {
+	if opts.MinSize == 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.Compressors) == 0 {
+		opts.Compressors = DefaultCompressors
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			res, err = next(ctx, req)
+			if err != nil || res.StatusCode < 200 || res.StatusCode >= 300 ||
+				res.StatusCode == http.StatusNoContent || isStreamed(ctx) {
+				return res, err
+			}
+
+			compressor, ok := negotiateCompressor(
+				headerValue(req.Headers, "Accept-Encoding"),
+				opts.Compressors,
+			)
+			if !ok {
+				return res, nil
+			}
+
+			if hasHeader(res.Headers, "Content-Encoding") ||
+				isCompressedContentType(headerValue(res.Headers, "Content-Type")) {
+				return res, nil
+			}
+
+			return compressResponse(res, compressor, opts.MinSize), nil
+		}
+	}
+}
+
+// negotiateCompressor returns the compressor with the highest quality
+// according to the value of an "Accept-Encoding" header, with ties broken by
+// the order of the compressors.
+func negotiateCompressor(acceptEncoding string, compressors []Compressor) (
+	Compressor,
+	bool,
+) {
+	if acceptEncoding == "" {
+		return Compressor{}, false
+	}
+
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+
+		qs[coding] = q
+	}
+
+	var best Compressor
+	bestQ := 0.0
+	for _, compressor := range compressors {
+		q, ok := qs[strings.ToLower(compressor.Encoding)]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = compressor, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+func isCompressedContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, compressed := range compressedTypes {
+		if mediaType == compressed ||
+			(strings.HasSuffix(compressed, "/") && strings.HasPrefix(mediaType, compressed)) {
+			return mediaType != "image/svg+xml"
+		}
+	}
+
+	return false
+}
+
+// compressResponse compresses the body of a response. If the body is too
+// small, or compression fails or does not make the body smaller, the response
+// is returned unmodified.
+func compressResponse(
+	res events.APIGatewayProxyResponse,
+	compressor Compressor,
+	minSize int,
+) events.APIGatewayProxyResponse {
+	body := []byte(res.Body)
+	if res.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(res.Body)
+		if err != nil {
+			return res
+		}
+	}
+
+	if len(body) < minSize {
+		return res
+	}
+
+	var buf bytes.Buffer
+	w, err := compressor.NewWriter(&buf)
+	if err != nil {
+		return res
+	}
+	if _, err = w.Write(body); err != nil {
+		return res
+	}
+	if err = w.Close(); err != nil {
+		return res
+	}
+
+	if buf.Len() >= len(body) {
+		return res
+	}
+
+	headers := make(map[string]string, len(res.Headers)+2)
+	for key, value := range res.Headers {
+		if strings.EqualFold(key, "Content-Length") {
+			continue
+		}
+		headers[key] = value
+	}
+	headers["Content-Encoding"] = compressor.Encoding
+	addVary(headers, "Accept-Encoding")
+
+	res.Headers = headers
+	res.IsBase64Encoded = true
+	res.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	return res
+}
+
+// addVary adds a header name to the "Vary" header in a map of headers, unless
+// it is already included.
+func addVary(headers map[string]string, name string) {
+	for key, value := range headers {
+		if !strings.EqualFold(key, "Vary") {
+			continue
+		}
+
+		for _, existing := range strings.Split(value, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, name) {
+				return
+			}
+		}
+
+		if strings.TrimSpace(value) == "" {
+			headers[key] = name
+		} else {
+			headers[key] = value + ", " + name
+		}
+		return
+	}
+
+	headers["Vary"] = name
+}
+
+const defaultMaxBodySize = 10 << 20
+
+// decompressBody decompresses a request body according to the value of the
+// request's "Content-Encoding" header, which may list multiple codings in the
+// order they were applied. Bodies that decompress to more than maxSize bytes
+// are rejected with a 413 HTTPError, malformed bodies are rejected with a 400
+// HTTPError, and unsupported codings are rejected with a 415 HTTPError.
+func decompressBody(contentEncoding string, body []byte, maxSize int64) (
+	[]byte,
+	error,
+) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+
+		var r io.Reader
+		var err error
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			// "deflate" is supposed to be zlib-wrapped, but some clients send
+			// raw deflate data
+			r, err = zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				r, err = flate.NewReader(bytes.NewReader(body)), nil
+			}
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, HTTPError{
+				Code:    http.StatusUnsupportedMediaType,
+				Message: fmt.Sprintf("unsupported content encoding %q", coding),
+			}
+		}
+		if err != nil {
+			return nil, invalidBodyEncodingError(coding, err)
+		}
+
+		body, err = io.ReadAll(io.LimitReader(r, maxSize+1))
+		if err != nil {
+			return nil, invalidBodyEncodingError(coding, err)
+		}
+
+		if int64(len(body)) > maxSize {
+			return nil, HTTPError{
+				Code: http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf(
+					"request body must not be larger than %d bytes",
+					maxSize,
+				),
+			}
+		}
+	}
+
+	return body, nil
+}
+
+func invalidBodyEncodingError(coding string, err error) error {
+	return HTTPError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("invalid %s request body: %s", coding, err),
+	}
+}
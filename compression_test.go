@@ -0,0 +1,157 @@
+package lmdrouter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	largeBody := strings.Repeat(`{"id":"bla","name":"Fake Item"},`, 100)
+
+	respond := func(res events.APIGatewayProxyResponse) Handler {
+		return func(_ context.Context, _ events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			return res, nil
+		}
+	}
+
+	jsonResponse := events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":   "application/json; charset=UTF-8",
+			"Content-Length": "3200",
+			"Vary":           "Accept",
+		},
+		Body: largeBody,
+	}
+
+	run := func(acceptEncoding string, res events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+		handler := CompressionMiddleware(CompressionOptions{})(respond(res))
+		req := events.APIGatewayProxyRequest{
+			Headers: map[string]string{
+				"accept-encoding": acceptEncoding,
+			},
+		}
+
+		out, err := handler(context.Background(), req)
+		assert.Equal(t, nil, err, "Error must be nil")
+		return out
+	}
+
+	decompress := func(res events.APIGatewayProxyResponse, newReader func(io.Reader) io.Reader) string {
+		b, err := base64.StdEncoding.DecodeString(res.Body)
+		assert.Equal(t, nil, err, "body must be valid base64")
+
+		out, err := io.ReadAll(newReader(bytes.NewReader(b)))
+		assert.Equal(t, nil, err, "body must be decompressed")
+		return string(out)
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		res := run("gzip, deflate", jsonResponse)
+		assert.True(t, res.IsBase64Encoded, "body must be base64 encoded")
+		assert.Equal(t, "gzip", res.Headers["Content-Encoding"], "Content-Encoding must be gzip")
+		assert.Equal(t, "Accept, Accept-Encoding", res.Headers["Vary"], "Vary must include Accept-Encoding")
+		assert.Equal(t, "", res.Headers["Content-Length"], "Content-Length must be removed")
+		assert.Equal(t, largeBody, decompress(res, func(r io.Reader) io.Reader {
+			gr, err := gzip.NewReader(r)
+			assert.Equal(t, nil, err, "gzip reader must be created")
+			return gr
+		}), "body must be correct")
+	})
+
+	t.Run("brotli preferred", func(t *testing.T) {
+		res := run("gzip, deflate, br", jsonResponse)
+		assert.Equal(t, "br", res.Headers["Content-Encoding"], "Content-Encoding must be br")
+		assert.Equal(t, largeBody, decompress(res, func(r io.Reader) io.Reader {
+			return brotli.NewReader(r)
+		}), "body must be correct")
+	})
+
+	inflate := func(r io.Reader) io.Reader {
+		zr, err := zlib.NewReader(r)
+		assert.Equal(t, nil, err, "body must be zlib-wrapped")
+		return zr
+	}
+
+	t.Run("quality values", func(t *testing.T) {
+		res := run("br;q=0, gzip;q=0, *;q=0.5", jsonResponse)
+		assert.Equal(t, "deflate", res.Headers["Content-Encoding"], "Content-Encoding must be deflate")
+		assert.Equal(t, largeBody, decompress(res, inflate), "body must be correct")
+
+		res = run("gzip;q=1, br;q=0.1", jsonResponse)
+		assert.Equal(t, "gzip", res.Headers["Content-Encoding"], "Highest quality must be preferred")
+
+		res = run("deflate, gzip", jsonResponse)
+		assert.Equal(t, "gzip", res.Headers["Content-Encoding"], "Ties must be broken by server order")
+	})
+
+	t.Run("base64 body", func(t *testing.T) {
+		res := jsonResponse
+		res.IsBase64Encoded = true
+		res.Body = base64.StdEncoding.EncodeToString([]byte(largeBody))
+
+		res = run("deflate", res)
+		assert.Equal(t, "deflate", res.Headers["Content-Encoding"], "Content-Encoding must be deflate")
+		assert.Equal(t, largeBody, decompress(res, inflate), "body must be correct")
+	})
+
+	t.Run("uncompressed responses", func(t *testing.T) {
+		errRes, _ := HandleError(HTTPError{http.StatusBadRequest, strings.Repeat("invalid input ", 100)})
+		small := jsonResponse
+		small.Body = `{"id":"bla"}`
+		image := jsonResponse
+		image.Headers = map[string]string{"Content-Type": "image/png"}
+		encoded := jsonResponse
+		encoded.Headers = map[string]string{"Content-Encoding": "identity"}
+
+		for name, test := range map[string]struct {
+			acceptEncoding string
+			res            events.APIGatewayProxyResponse
+		}{
+			"no accept-encoding":   {"", jsonResponse},
+			"unsupported encoding": {"compress, gzip;q=0", jsonResponse},
+			"error response":       {"gzip", errRes},
+			"small body":           {"gzip", small},
+			"compressed content":   {"gzip", image},
+			"already encoded":      {"gzip", encoded},
+		} {
+			res := run(test.acceptEncoding, test.res)
+			assert.Equal(t, test.res.Body, res.Body, "body must not be modified for "+name)
+			assert.Equal(t, test.res.IsBase64Encoded, res.IsBase64Encoded, "body must not be encoded for "+name)
+		}
+	})
+
+	t.Run("ServeHTTP", func(t *testing.T) {
+		lmd := NewRouter("/api", CompressionMiddleware(CompressionOptions{MinSize: 10}))
+		lmd.Route("GET", "/", respond(jsonResponse))
+
+		req := httptest.NewRequest("GET", "/api", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		lmd.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, "status code must be 200")
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"), "Content-Encoding must be gzip")
+
+		gr, err := gzip.NewReader(w.Body)
+		assert.Equal(t, nil, err, "gzip reader must be created")
+		body, err := io.ReadAll(gr)
+		assert.Equal(t, nil, err, "body must be decompressed")
+		assert.Equal(t, largeBody, string(body), "body must be correct")
+	})
+}
@@ -3,57 +3,215 @@ package lmdrouter
 // nolint: unused
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 )
 
-var boolRegex = regexp.MustCompile(`^1|true|on|enabled$`)
+var (
+	defaultTrueValues  = []string{"1", "true", "on", "enabled"}
+	defaultFalseValues = []string{"0", "false", "off", "disabled"}
+)
+
+// DecoderOptions modify the behavior of UnmarshalRequestWithOptions. The zero
+// value is valid, and corresponds to the behavior of UnmarshalRequest.
+type DecoderOptions struct {
+	// Strict enables strict decoding. In strict mode, boolean parameters that
+	// are neither in TrueValues nor in FalseValues, query string parameters
+	// that do not correspond to any field of the target struct, and JSON
+	// bodies with unknown fields are rejected with a 400 Bad Request
+	// HTTPError. In non-strict mode, boolean parameters that are not in
+	// TrueValues are considered false, and unknown parameters and fields are
+	// ignored.
+	Strict bool
+
+	// TrueValues is the list of values (compared case-insensitively) that are
+	// accepted as true for boolean fields. If empty, the values "1", "true",
+	// "on" and "enabled" are used.
+	TrueValues []string
+
+	// FalseValues is the list of values (compared case-insensitively) that are
+	// accepted as false for boolean fields in strict mode. If empty, the
+	// values "0", "false", "off" and "disabled" are used.
+	FalseValues []string
+
+	// MaxBodySize is the maximum size, in bytes, of request bodies after
+	// decompression (see UnmarshalRequest). Larger bodies are rejected with a
+	// 413 Request Entity Too Large HTTPError. If zero, 10MiB is used.
+	MaxBodySize int64
+}
+
+func (opts DecoderOptions) parseBool(param, str string) (bool, error) {
+	trueValues := opts.TrueValues
+	if len(trueValues) == 0 {
+		trueValues = defaultTrueValues
+	}
+
+	for _, value := range trueValues {
+		if strings.EqualFold(str, value) {
+			return true, nil
+		}
+	}
+
+	if !opts.Strict {
+		return false, nil
+	}
+
+	falseValues := opts.FalseValues
+	if len(falseValues) == 0 {
+		falseValues = defaultFalseValues
+	}
+
+	for _, value := range falseValues {
+		if strings.EqualFold(str, value) {
+			return false, nil
+		}
+	}
+
+	return false, HTTPError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("%s must be a valid boolean", param),
+	}
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// DecoderFunc is a function that parses a single string value taken from a
+// request (a path parameter, a query string parameter or a header) into a
+// value of a specific type. See RegisterDecoder for more information.
+type DecoderFunc func(string) (interface{}, error)
+
+var decoders = struct {
+	sync.RWMutex
+	funcs map[reflect.Type]DecoderFunc
+}{
+	funcs: map[reflect.Type]DecoderFunc{
+		reflect.TypeOf(time.Duration(0)): func(str string) (interface{}, error) {
+			return time.ParseDuration(str)
+		},
+	},
+}
+
+// RegisterDecoder registers a function that decodes request parameters into
+// values of type t. This is useful for types that you do not own and that do
+// not implement encoding.TextUnmarshaler, such as decimal types. Registered
+// decoders take precedence over the built-in decoding rules, and are used both
+// for fields of type t and for pointers and slices of t. The value returned by
+// fn must be of type t (or of a type convertible to it). If fn returns an
+// error, UnmarshalRequest will fail with a 400 Bad Request HTTPError. Since
+// registering a decoder invalidates all cached plans (see Precompile),
+// decoders should be registered during initialization.
+//
+// A decoder for time.Duration is registered by default.
+//
+// Example:
+//
+//     lmdrouter.RegisterDecoder(
+//         reflect.TypeOf(decimal.Decimal{}),
+//         func(str string) (interface{}, error) {
+//             return decimal.NewFromString(str)
+//         },
+//     )
+//
+func RegisterDecoder(t reflect.Type, fn DecoderFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	defer resetPlans()
+
+	if fn == nil {
+		delete(decoders.funcs, t)
+		return
+	}
+
+	decoders.funcs[t] = fn
+}
 
 // UnmarshalRequest "fills" out a target Go struct with data from the request.
 // If body is true, then the request body is assumed to be JSON and simply
 // unmarshaled into the target (taking into account that the request body may
-// be base-64 encoded). After that, or if body is false, the function will
-// traverse the exported fields of the target struct, and fill those that
-// include the "lambda" struct tag with values taken from the request's query
-// string parameters, path parameters and headers, according to the field's
-// struct tag definition. This means a struct value can be filled with data from
-// the body, the path, the query string and the headers at the same time.
+// be base-64 encoded, and may be compressed with gzip, deflate or brotli, as
+// declared by the request's "Content-Encoding" header). After that, or if
+// body is false, the function will traverse the exported fields of the target
+// struct, and fill those that include the "lambda" struct tag with values
+// taken from the request's query string parameters, path parameters and
+// headers, according to the field's struct tag definition. This means a
+// struct value can be filled with data from the body, the path, the query
+// string and the headers at the same time. Header names are matched in a
+// case-insensitive way, since API Gateway does not normalize them.
 //
 // Field types are currently limited to string, all integer types, all unsigned
-// integer types, all float types, booleans, slices of the aforementioned types
-// and pointers of these types.
+// integer types, all float types, booleans, pointers of these types, and
+// slices and fixed-size arrays of the aforementioned types (including slices
+// of pointers). Slices and arrays are filled either from multiple values of
+// the same parameter, from a single comma-separated value, or from multiple
+// values of the bracketed form of the parameter (e.g. "ids[]=1&ids[]=2").
+// Query string parameters in the OpenAPI "deepObject" style (e.g.
+// "filter[status]=open&filter[owner]=me") can be bound to map fields with
+// string keys (e.g. map[string]string or map[string][]int), using the tag
+// `lambda:"query.filter"`. Default values are not supported for maps (such
+// tags are reported as invalid). Values that cannot be parsed into the
+// field's type (including integers that overflow it) cause a 400 Bad Request
+// HTTPError.
 //
 // Note that custom types that alias any of the aforementioned types are also
 // accepted and the appropriate constant values will be generated. Boolean
 // fields accept (in a case-insensitive way) the values "1", "true", "on" and
-// "enabled". Any other value is considered false.
+// "enabled". Any other value is considered false. To change the accepted
+// values, or to reject invalid values, unknown query string parameters and
+// unknown body fields, use UnmarshalRequestWithOptions or the router's
+// UnmarshalRequest method.
+//
+// The lambda struct tag may include comma-separated options after the
+// parameter name. The "required" option causes UnmarshalRequest to fail with a
+// 400 Bad Request HTTPError if the parameter is missing or empty. The
+// "default=<value>" option provides a value to use when the parameter is
+// missing or empty; it is parsed just like a value taken from the request, so
+// slice fields accept comma-separated defaults. Since default values may
+// contain commas, the "default" option must always be the last one.
+//
+// Fields of any other type are supported if a decoder was registered for the
+// type via RegisterDecoder, or if the type implements encoding.TextUnmarshaler
+// (e.g. time.Time, which is parsed in RFC 3339 format, and net.IP). Fields of
+// type time.Time (or *time.Time) may also include a "layout" struct tag with a
+// layout string for time.Parse. Fields of embedded structs (e.g. PageRequest)
+// are filled as well.
+//
+// The struct tags of a target type are parsed the first time the type is
+// used, and the result is cached for subsequent calls. Invalid struct tags
+// and unsupported field types are reported at that time, as errors that are
+// not HTTPErrors. Use Precompile to detect such errors during initialization.
 //
 // Example struct (no body):
 //
 //     type ListPostsInput struct {
-//         ID          uint64   `lambda:"path.id"`
-//         Page        uint64   `lambda:"query.page"`
-//         PageSize    uint64   `lambda:"query.page_size"`
-//         Search      string   `lambda:"query.search"`
-//         ShowDrafts  bool     `lambda:"query.show_hidden"`
-//         Languages   []string `lambda:"header.Accept-Language"`
+//         ID          uint64    `lambda:"path.id"`
+//         Page        uint64    `lambda:"query.page,default=1"`
+//         PageSize    uint64    `lambda:"query.page_size,default=20"`
+//         Search      string    `lambda:"query.search"`
+//         ShowDrafts  bool      `lambda:"query.show_hidden"`
+//         Languages   []string  `lambda:"header.Accept-Language"`
+//         Since       time.Time `lambda:"query.since" layout:"2006-01-02"`
 //     }
 //
 // Example struct (JSON body):
 //
 //     type UpdatePostInput struct {
 //         ID          uint64   `lambda:"path.id"`
-//         Author      string   `lambda:"header.Author"`
+//         Author      string   `lambda:"header.Author,required"`
 //         Title       string   `json:"title"`
 //         Content     string   `json:"content"`
 //     }
@@ -62,85 +220,199 @@ func UnmarshalRequest(
 	req events.APIGatewayProxyRequest,
 	body bool,
 	target interface{},
+) error {
+	return UnmarshalRequestWithOptions(req, body, target, DecoderOptions{})
+}
+
+// UnmarshalRequestWithOptions is the same as UnmarshalRequest, but allows
+// modifying the decoding behavior, most notably to enable strict decoding.
+// See DecoderOptions for more information.
+func UnmarshalRequestWithOptions(
+	req events.APIGatewayProxyRequest,
+	body bool,
+	target interface{},
+	opts DecoderOptions,
 ) error {
 	if body {
-		err := unmarshalBody(req, target)
+		err := unmarshalBody(req, target, opts)
 		if err != nil {
 			return err
 		}
 	}
 
-	return unmarshalEvent(req, target)
+	return unmarshalEvent(req, target, opts)
+}
+
+// UnmarshalRequest is the same as the UnmarshalRequest function, but uses the
+// router's DecoderOptions. This allows enabling strict decoding for all
+// handlers of the router:
+//
+//     router = lmdrouter.NewRouter("/api")
+//     router.DecoderOptions.Strict = true
+//
+//     ...
+//
+//     err = router.UnmarshalRequest(req, false, &input)
+//
+func (l *Router) UnmarshalRequest(
+	req events.APIGatewayProxyRequest,
+	body bool,
+	target interface{},
+) error {
+	return UnmarshalRequestWithOptions(req, body, target, l.DecoderOptions)
 }
 
-func unmarshalEvent(req events.APIGatewayProxyRequest, target interface{}) error {
+func unmarshalEvent(
+	req events.APIGatewayProxyRequest,
+	target interface{},
+	opts DecoderOptions,
+) error {
 	rv := reflect.ValueOf(target)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return errors.New("invalid unmarshal target, must be pointer to struct")
 	}
 
 	v := rv.Elem()
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		typeField := t.Field(i)
-		valueField := v.Field(i)
-
-		lambdaTag := typeField.Tag.Get("lambda")
-		if lambdaTag == "" {
-			continue
-		}
-
-		components := strings.Split(lambdaTag, ".")
-		if len(components) != 2 {
-			return fmt.Errorf("invalid lambda tag for field %s", typeField.Name)
-		}
+	plan, err := planFor(v.Type())
+	if err != nil {
+		return err
+	}
 
+	for _, field := range plan.fields {
 		var sourceMap map[string]string
 		var multiMap map[string][]string
 
-		switch components[0] {
+		switch field.tag.location {
 		case "query":
 			sourceMap = req.QueryStringParameters
 			multiMap = req.MultiValueQueryStringParameters
 		case "path":
 			sourceMap = req.PathParameters
 		case "header":
-			sourceMap = req.Headers
-			multiMap = req.MultiValueHeaders
-		default:
-			return fmt.Errorf(
-				"invalid param location %q for field %s",
-				components[0], typeField.Name,
-			)
+			sourceMap = headerParams(req.Headers, field.tag.name)
+			multiMap = headerParams(req.MultiValueHeaders, field.tag.name)
 		}
 
-		err := unmarshalField(
-			typeField.Type,
-			valueField,
+		if !hasParam(field.kind, sourceMap, multiMap, field.tag.name) {
+			switch {
+			case field.tag.hasDefault:
+				sourceMap = map[string]string{field.tag.name: field.tag.defaultValue}
+				multiMap = nil
+			case field.tag.required:
+				return HTTPError{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("%s is required", field.tag.name),
+				}
+			}
+		}
+
+		err = field.bind(
+			v.FieldByIndex(field.index),
 			sourceMap,
 			multiMap,
-			components[1],
+			field.tag.name,
+			opts,
 		)
 		if err != nil {
 			return err
 		}
 	}
+
+	if opts.Strict {
+		return checkUnknownParams(req, plan.queryParams)
+	}
+
 	return nil
 }
 
-func unmarshalBody(req events.APIGatewayProxyRequest, target interface{}) (
-	err error,
-) {
+// checkUnknownParams fails with a 400 Bad Request HTTPError if the request
+// includes query string parameters that do not correspond to any of the
+// parameters in known, which maps parameter names to their binding kind.
+func checkUnknownParams(
+	req events.APIGatewayProxyRequest,
+	known map[string]reflect.Kind,
+) error {
+	var unknown []string
+	for param := range req.QueryStringParameters {
+		if !isKnownParam(known, param) {
+			unknown = append(unknown, param)
+		}
+	}
+	for param := range req.MultiValueQueryStringParameters {
+		_, ok := req.QueryStringParameters[param]
+		if !ok && !isKnownParam(known, param) {
+			unknown = append(unknown, param)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+
+	return HTTPError{
+		Code: http.StatusBadRequest,
+		Message: fmt.Sprintf(
+			"unknown query parameter(s): %s",
+			strings.Join(unknown, ", "),
+		),
+	}
+}
+
+func isKnownParam(known map[string]reflect.Kind, param string) bool {
+	if _, ok := known[param]; ok {
+		return true
+	}
+
+	if name := strings.TrimSuffix(param, "[]"); name != param {
+		return known[name] == reflect.Slice
+	}
+
+	if i := strings.IndexByte(param, '['); i > 0 && known[param[:i]] == reflect.Map {
+		_, ok := mapParamKey(param[:i], param)
+		return ok
+	}
+
+	return false
+}
+
+func unmarshalBody(
+	req events.APIGatewayProxyRequest,
+	target interface{},
+	opts DecoderOptions,
+) (err error) {
+	body := []byte(req.Body)
 	if req.IsBase64Encoded {
-		var body []byte
 		body, err = base64.StdEncoding.DecodeString(req.Body)
 		if err != nil {
-			return fmt.Errorf("failed decoding body: %w", err)
+			return invalidBodyEncodingError("base64", err)
 		}
+	}
 
-		err = json.Unmarshal(body, target)
+	maxSize := opts.MaxBodySize
+	if maxSize == 0 {
+		maxSize = defaultMaxBodySize
+	}
+
+	body, err = decompressBody(
+		headerValue(req.Headers, "Content-Encoding"),
+		body,
+		maxSize,
+	)
+	if err != nil {
+		return err
+	}
+
+	if opts.Strict {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(target)
+		if err == nil && dec.More() {
+			err = errors.New("unexpected data after JSON value")
+		}
 	} else {
-		err = json.Unmarshal([]byte(req.Body), target)
+		err = json.Unmarshal(body, target)
 	}
 
 	if err != nil {
@@ -153,142 +425,62 @@ func unmarshalBody(req events.APIGatewayProxyRequest, target interface{}) (
 	return nil
 }
 
-func unmarshalField(
-	typeField reflect.Type,
-	valueField reflect.Value,
+// hasParam returns true if the parameter exists in the request with a
+// non-empty value, taking into account the binding kind of its field. Since
+// API Gateway fills both the single- and multi-value maps, multi-value
+// parameters whose values are all empty (e.g. "?ids=") are considered
+// missing.
+func hasParam(
+	kind reflect.Kind,
 	params map[string]string,
 	multiParam map[string][]string,
 	param string,
-) error {
-	switch typeField.Kind() {
-	case reflect.String:
-		valueField.SetString(params[param])
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		str, ok := params[param]
-		value, err := parseInt64Param(param, str, ok)
-		if err != nil {
-			return err
-		}
-		valueField.SetInt(value)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		str, ok := params[param]
-		value, err := parseUint64Param(param, str, ok)
-		if err != nil {
-			return err
-		}
-		valueField.SetUint(value)
-	case reflect.Float32, reflect.Float64:
-		str, ok := params[param]
-		value, err := parseFloat64Param(param, str, ok)
-		if err != nil {
-			return err
-		}
-		valueField.SetFloat(value)
-	case reflect.Bool:
-		valueField.SetBool(boolRegex.MatchString(strings.ToLower(params[param])))
-	case reflect.Ptr:
-		if val, ok := params[param]; ok {
-			switch typeField.Elem().Kind() {
-			case reflect.Int, reflect.Int32, reflect.Int64, reflect.String, reflect.Float32, reflect.Float64:
-				valueField.Set(reflect.ValueOf(&val).Convert(typeField))
-			case reflect.Struct:
-				if typeField.Elem() == reflect.TypeOf(time.Now()) {
-					parsedTime, err := time.Parse(time.RFC3339, val)
-					if err != nil {
-						return err
-					}
-					valueField.Set(reflect.ValueOf(&parsedTime))
-				}
-			case reflect.Bool:
-				b := boolRegex.MatchString(strings.ToLower(val))
-				valueField.Set(reflect.ValueOf(&b))
+) bool {
+	switch kind {
+	case reflect.Map:
+		for key, value := range params {
+			if _, ok := mapParamKey(param, key); ok && value != "" {
+				return true
 			}
 		}
-	case reflect.Slice:
-		// we'll be extracting values from multiParam, generating a slice and
-		// putting it in valueField
-		strs, ok := multiParam[param]
-		if ok {
-			slice := reflect.MakeSlice(typeField, len(strs), len(strs))
-
-			for i, str := range strs {
-				err := unmarshalField(
-					typeField.Elem(),
-					slice.Index(i),
-					map[string]string{"param": str},
-					nil,
-					"param",
-				)
-				if err != nil {
-					return err
-				}
-			}
-
-			valueField.Set(slice)
-		} else {
-			str, ok := params[param]
-			if ok {
-				stringParts := strings.Split(str, ",")
-				slice := reflect.MakeSlice(typeField, len(stringParts), len(stringParts))
-
-				for i, p := range stringParts {
-					inVal := reflect.ValueOf(p)
-					asVal := inVal.Convert(typeField.Elem())
-					slice.Index(i).Set(asVal)
-				}
-
-				valueField.Set(slice)
+		for key, values := range multiParam {
+			if _, ok := mapParamKey(param, key); ok && hasValue(values) {
+				return true
 			}
 		}
-	}
-
-	return nil
-}
-
-func parseInt64Param(param, str string, ok bool) (value int64, err error) {
-	if !ok {
-		return value, nil
-	}
-
-	value, err = strconv.ParseInt(str, 10, 64)
-	if err != nil {
-		return value, HTTPError{
-			Code:    http.StatusBadRequest,
-			Message: fmt.Sprintf("%s must be a valid integer", param),
+		return false
+	case reflect.Slice:
+		if params[param+"[]"] != "" || hasValue(multiParam[param+"[]"]) {
+			return true
 		}
 	}
 
-	return value, nil
+	return params[param] != "" || hasValue(multiParam[param])
 }
 
-func parseUint64Param(param, str string, ok bool) (value uint64, err error) {
-	if !ok {
-		return value, nil
-	}
-
-	value, err = strconv.ParseUint(str, 10, 64)
-	if err != nil {
-		return value, HTTPError{
-			Code:    http.StatusBadRequest,
-			Message: fmt.Sprintf("%s must be a valid, positive integer", param),
+// hasValue returns true if any of the provided values is non-empty.
+func hasValue(values []string) bool {
+	for _, value := range values {
+		if value != "" {
+			return true
 		}
 	}
 
-	return value, nil
+	return false
 }
 
-func parseFloat64Param(param, str string, ok bool) (value float64, err error) {
-	if !ok {
-		return value, nil
+// mapParamKey checks if key is a bracketed form of param (e.g. if param is
+// "filter" and key is "filter[status]"), and if so returns the inner key
+// (e.g. "status").
+func mapParamKey(param, key string) (string, bool) {
+	if !strings.HasPrefix(key, param+"[") || !strings.HasSuffix(key, "]") {
+		return "", false
 	}
 
-	value, err = strconv.ParseFloat(str, 64)
-	if err != nil {
-		return value, HTTPError{
-			Code:    http.StatusBadRequest,
-			Message: fmt.Sprintf("%s must be a valid floating point number", param),
-		}
+	inner := key[len(param)+1 : len(key)-1]
+	if inner == "" || strings.ContainsAny(inner, "[]") {
+		return "", false
 	}
 
-	return value, nil
+	return inner, true
 }
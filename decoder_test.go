@@ -1,11 +1,21 @@
 package lmdrouter
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/jgroeneveld/trial/assert"
 )
@@ -154,4 +164,701 @@ func Test_UnmarshalRequest(t *testing.T) {
 
 		assert.NotEqual(t, nil, err, "Error must not be nil")
 	})
+
+	t.Run("invalid base64 body", func(t *testing.T) {
+		var input mockPostRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				IsBase64Encoded: true,
+				Body:            "this is not base64!",
+			},
+			true,
+			&input,
+		)
+
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+	})
+}
+
+func Test_UnmarshalRequest_CustomTypes(t *testing.T) {
+	RegisterDecoder(reflect.TypeOf(mockPoint{}), func(str string) (interface{}, error) {
+		var p mockPoint
+		_, err := fmt.Sscanf(str, "%d:%d", &p.X, &p.Y)
+		return p, err
+	})
+	defer RegisterDecoder(reflect.TypeOf(mockPoint{}), nil)
+
+	t.Run("valid input", func(t *testing.T) {
+		var input mockCustomRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"upper":   "hello",
+					"pupper":  "world",
+					"point":   "1:2",
+					"ppoint":  "3:4",
+					"timeout": "1m30s",
+					"time":    "2021-11-01T11:11:11Z",
+					"date":    "2021-11-01",
+					"pdate":   "02/11/2021",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"uppers": []string{"one", "two"},
+				},
+				Headers: map[string]string{
+					"X-Forwarded-For": "10.0.0.1",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, mockUpper("HELLO"), input.Upper, "Upper must be parsed via UnmarshalText")
+		assert.NotNil(t, input.PUpper, "PUpper must not be nil")
+		assert.Equal(t, mockUpper("WORLD"), *input.PUpper, "PUpper must be parsed via UnmarshalText")
+		assert.DeepEqual(t, []mockUpper{"ONE", "TWO"}, input.Uppers, "Uppers must be parsed via UnmarshalText")
+		assert.Equal(t, mockPoint{1, 2}, input.Point, "Point must be parsed via registered decoder")
+		assert.NotNil(t, input.PPoint, "PPoint must not be nil")
+		assert.Equal(t, mockPoint{3, 4}, *input.PPoint, "PPoint must be parsed via registered decoder")
+		assert.Equal(t, 90*time.Second, input.Timeout, "Timeout must be parsed as a duration")
+		assert.True(t, net.ParseIP("10.0.0.1").Equal(input.IP), "IP must be parsed from header")
+		assert.Equal(t, time.Date(2021, 11, 1, 11, 11, 11, 0, time.UTC), input.Time, "Time must be parsed as RFC 3339")
+		assert.Equal(t, time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC), input.Date, "Date must be parsed with layout")
+		assert.NotNil(t, input.PDate, "PDate must not be nil")
+		assert.Equal(t, time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC), *input.PDate, "PDate must be parsed with layout")
+		assert.True(t, input.NotGiven.IsZero(), "NotGiven must be zero")
+	})
+
+	for param, value := range map[string]string{
+		"upper":   "",
+		"point":   "bla",
+		"timeout": "forever",
+		"time":    "yesterday",
+		"date":    "2021-11-01T11:11:11Z",
+	} {
+		t.Run("invalid "+param, func(t *testing.T) {
+			var input mockCustomRequest
+			err := UnmarshalRequest(
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{
+						param: value,
+					},
+				},
+				false,
+				&input,
+			)
+			assert.NotEqual(t, nil, err, "Error must not be nil")
+			var httpErr HTTPError
+			ok := errors.As(err, &httpErr)
+			assert.True(t, ok, "Error must be an HTTPError")
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+		})
+	}
+}
+
+func Test_UnmarshalRequest_TagOptions(t *testing.T) {
+	t.Run("defaults applied", func(t *testing.T) {
+		var input mockDefaultsRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				Headers: map[string]string{
+					"X-Tenant": "acme",
+				},
+				QueryStringParameters: map[string]string{
+					"page": "",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "acme", input.Tenant, "Tenant must be parsed from headers")
+		assert.Equal(t, int64(1), input.Page, "Page must have default value")
+		assert.NotNil(t, input.Order, "Order must not be nil")
+		assert.Equal(t, "asc", *input.Order, "Order must have default value")
+		assert.DeepEqual(t, []string{"name", "-date"}, input.Sort, "Sort must have default value")
+		assert.Equal(t, "all", input.Filter, "Filter must have default value")
+	})
+
+	t.Run("defaults not applied", func(t *testing.T) {
+		var input mockDefaultsRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				Headers: map[string]string{
+					"X-Tenant": "acme",
+				},
+				QueryStringParameters: map[string]string{
+					"page":   "0",
+					"order":  "desc",
+					"filter": "mine",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"sort": []string{"date"},
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, int64(0), input.Page, "Page must be parsed from query")
+		assert.Equal(t, "desc", *input.Order, "Order must be parsed from query")
+		assert.DeepEqual(t, []string{"date"}, input.Sort, "Sort must be parsed from query")
+		assert.Equal(t, "mine", input.Filter, "Filter must be parsed from query")
+	})
+
+	t.Run("missing required parameter", func(t *testing.T) {
+		var input mockDefaultsRequest
+		err := UnmarshalRequest(events.APIGatewayProxyRequest{}, false, &input)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+		assert.Equal(t, "X-Tenant is required", httpErr.Message, "Error message must be correct")
+	})
+
+	t.Run("lowercase header names", func(t *testing.T) {
+		var input struct {
+			Tenant    string   `lambda:"header.X-Tenant,required"`
+			Languages []string `lambda:"header.Accept-Language"`
+		}
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				Headers: map[string]string{
+					"x-tenant":        "acme",
+					"accept-language": "en",
+				},
+				MultiValueHeaders: map[string][]string{
+					"x-tenant":        []string{"acme"},
+					"accept-language": []string{"en", "de"},
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "acme", input.Tenant, "Tenant must be parsed from headers")
+		assert.DeepEqual(t, []string{"en", "de"}, input.Languages, "Languages must be parsed from headers")
+	})
+
+	t.Run("empty values in both maps", func(t *testing.T) {
+		var input mockDefaultsRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				Headers: map[string]string{
+					"X-Tenant": "acme",
+				},
+				QueryStringParameters: map[string]string{
+					"sort": "",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"sort": []string{""},
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.DeepEqual(t, []string{"name", "-date"}, input.Sort, "Sort must have default value")
+
+		var required struct {
+			IDs []int `lambda:"query.ids,required"`
+		}
+		err = UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"ids": "",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"ids": []string{""},
+				},
+			},
+			false,
+			&required,
+		)
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+		assert.Equal(t, "ids is required", httpErr.Message, "Error message must be correct")
+	})
+
+	t.Run("invalid tag option", func(t *testing.T) {
+		var input struct {
+			Page int64 `lambda:"query.page,optional"`
+		}
+		err := UnmarshalRequest(events.APIGatewayProxyRequest{}, false, &input)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+	})
+}
+
+func Test_UnmarshalRequest_Scalars(t *testing.T) {
+	t.Run("valid input", func(t *testing.T) {
+		var input mockScalarsRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"int8":     "-12",
+					"uint16":   "65535",
+					"float32":  "1.5",
+					"pint":     "-3",
+					"pint8":    "127",
+					"puint64":  "18446744073709551615",
+					"pfloat32": "2.25",
+					"pstring":  "bla",
+					"ints":     "1,2,3",
+					"floats":   "1.2,3.5",
+					"uints":    "4,5",
+					"bools":    "true,false",
+					"pints":    "7,8",
+					"array":    "1,2",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"pstrings": []string{"one", "two"},
+				},
+				Headers: map[string]string{
+					"X-Weights": "0.5,1.5",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, int8(-12), input.Int8, "Int8 must be parsed")
+		assert.Equal(t, uint16(65535), input.Uint16, "Uint16 must be parsed")
+		assert.Equal(t, float32(1.5), input.Float32, "Float32 must be parsed")
+		assert.Equal(t, -3, *input.PInt, "PInt must be parsed")
+		assert.Equal(t, int8(127), *input.PInt8, "PInt8 must be parsed")
+		assert.Equal(t, uint64(18446744073709551615), *input.PUint64, "PUint64 must be parsed")
+		assert.Equal(t, float32(2.25), *input.PFloat32, "PFloat32 must be parsed")
+		assert.Equal(t, "bla", *input.PString, "PString must be parsed")
+		assert.DeepEqual(t, []int{1, 2, 3}, input.Ints, "Ints must be parsed from comma-separated value")
+		assert.DeepEqual(t, []float64{1.2, 3.5}, input.Floats, "Floats must be parsed from comma-separated value")
+		assert.DeepEqual(t, []uint8{4, 5}, input.Uints, "Uints must be parsed from comma-separated value")
+		assert.DeepEqual(t, []bool{true, false}, input.Bools, "Bools must be parsed from comma-separated value")
+		assert.Equal(t, 2, len(input.PInts), "PInts must have 2 items")
+		assert.Equal(t, 7, *input.PInts[0], "PInts[0] must be parsed")
+		assert.Equal(t, 8, *input.PInts[1], "PInts[1] must be parsed")
+		assert.Equal(t, [3]int{1, 2, 0}, input.Array, "Array must be parsed")
+		assert.Equal(t, 2, len(input.PStrings), "PStrings must have 2 items")
+		assert.Equal(t, "two", *input.PStrings[1], "PStrings[1] must be parsed")
+		assert.Equal(t, [2]float32{0.5, 1.5}, input.Weights, "Weights must be parsed from header")
+	})
+
+	for param, value := range map[string]string{
+		"int8":     "128",
+		"uint16":   "-1",
+		"float32":  "1e40",
+		"pint":     "abc",
+		"pint8":    "-129",
+		"puint64":  "1.5",
+		"pfloat32": "bla",
+		"ints":     "1,two,3",
+		"floats":   "1.2,,3.5",
+		"uints":    "1,256",
+		"pints":    "1,x",
+		"array":    "1,2,3,4",
+	} {
+		t.Run("invalid "+param, func(t *testing.T) {
+			var input mockScalarsRequest
+			err := UnmarshalRequest(
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{
+						param: value,
+					},
+				},
+				false,
+				&input,
+			)
+			assert.NotEqual(t, nil, err, "Error must not be nil")
+			var httpErr HTTPError
+			ok := errors.As(err, &httpErr)
+			assert.True(t, ok, "Error must be an HTTPError")
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+		})
+	}
+
+	t.Run("unsupported type", func(t *testing.T) {
+		var input struct {
+			Channel chan int `lambda:"query.channel"`
+		}
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"channel": "bla",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		var httpErr HTTPError
+		assert.False(t, errors.As(err, &httpErr), "Error must not be an HTTPError")
+	})
+}
+
+func Test_UnmarshalRequestWithOptions(t *testing.T) {
+	t.Run("non-strict booleans", func(t *testing.T) {
+		for value, expected := range map[string]bool{
+			"1":        true,
+			"TRUE":     true,
+			"Enabled":  true,
+			"1abc":     false,
+			"xenabled": false,
+			"bla":      false,
+		} {
+			var input mockGetRequest
+			err := UnmarshalRequest(
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{
+						"show_something": value,
+					},
+				},
+				false,
+				&input,
+			)
+			assert.Equal(t, nil, err, "Error must be nil")
+			assert.Equal(t, expected, input.ShowSomething, "ShowSomething must be correct for "+value)
+		}
+	})
+
+	t.Run("strict booleans", func(t *testing.T) {
+		opts := DecoderOptions{Strict: true}
+		for value, expected := range map[string]bool{
+			"on":       true,
+			"OFF":      false,
+			"disabled": false,
+			"0":        false,
+		} {
+			var input mockGetRequest
+			err := UnmarshalRequestWithOptions(
+				events.APIGatewayProxyRequest{
+					QueryStringParameters: map[string]string{
+						"show_something": value,
+					},
+				},
+				false,
+				&input,
+				opts,
+			)
+			assert.Equal(t, nil, err, "Error must be nil")
+			assert.Equal(t, expected, input.ShowSomething, "ShowSomething must be correct for "+value)
+		}
+
+		var input mockGetRequest
+		err := UnmarshalRequestWithOptions(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"show_something": "1abc",
+				},
+			},
+			false,
+			&input,
+			opts,
+		)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+	})
+
+	t.Run("custom boolean values", func(t *testing.T) {
+		opts := DecoderOptions{
+			Strict:      true,
+			TrueValues:  []string{"yes", "y"},
+			FalseValues: []string{"no", "n"},
+		}
+
+		var input mockGetRequest
+		err := UnmarshalRequestWithOptions(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"show_something": "Y",
+				},
+			},
+			false,
+			&input,
+			opts,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.True(t, input.ShowSomething, "ShowSomething must be true")
+
+		err = UnmarshalRequestWithOptions(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"show_something": "true",
+				},
+			},
+			false,
+			&input,
+			opts,
+		)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+	})
+
+	t.Run("strict unknown query parameters", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{
+				"id": "bla",
+			},
+			QueryStringParameters: map[string]string{
+				"show_something": "true",
+				"show_nothing":   "true",
+			},
+			MultiValueQueryStringParameters: map[string][]string{
+				"show_something": []string{"true"},
+				"show_nothing":   []string{"true"},
+				"other":          []string{"1", "2"},
+			},
+		}
+
+		var input mockGetRequest
+		err := UnmarshalRequest(req, false, &input)
+		assert.Equal(t, nil, err, "Error must be nil in non-strict mode")
+
+		err = UnmarshalRequestWithOptions(req, false, &input, DecoderOptions{Strict: true})
+		assert.NotEqual(t, nil, err, "Error must not be nil in strict mode")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+		assert.Equal(
+			t,
+			"unknown query parameter(s): other, show_nothing",
+			httpErr.Message,
+			"Error message must be correct",
+		)
+	})
+
+	t.Run("strict unknown body fields", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			Body: `{"name":"Fake Post","author":"Someone"}`,
+		}
+
+		var input mockPostRequest
+		err := UnmarshalRequest(req, true, &input)
+		assert.Equal(t, nil, err, "Error must be nil in non-strict mode")
+
+		err = UnmarshalRequestWithOptions(req, true, &input, DecoderOptions{Strict: true})
+		assert.NotEqual(t, nil, err, "Error must not be nil in strict mode")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+	})
+
+	t.Run("router options", func(t *testing.T) {
+		router := NewRouter("")
+		router.DecoderOptions.Strict = true
+
+		var input mockGetRequest
+		err := router.UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"show_something": "maybe",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+	})
+}
+
+func Test_UnmarshalRequest_DeepObjects(t *testing.T) {
+	t.Run("valid input", func(t *testing.T) {
+		var input mockFilterRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"filter[status]": "open",
+					"filter[owner]":  "me",
+					"range[size]":    "1,10",
+					"flags[draft]":   "true",
+					"ids[]":          "3",
+					"tags[]":         "a,b",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"filter[status]": []string{"open"},
+					"filter[owner]":  []string{"me"},
+					"range[date]":    []string{"2020", "2021"},
+					"ids[]":          []string{"1", "2"},
+				},
+			},
+			false,
+			&input,
+		)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.DeepEqual(
+			t,
+			map[string]string{"status": "open", "owner": "me"},
+			input.Filter,
+			"Filter must be parsed from deep object",
+		)
+		assert.DeepEqual(
+			t,
+			map[string][]int{"size": {1, 10}, "date": {2020, 2021}},
+			input.Ranges,
+			"Ranges must be parsed from deep object",
+		)
+		assert.Equal(t, 1, len(input.Flags), "Flags must have one item")
+		assert.NotNil(t, input.Flags["draft"], "Flags[draft] must not be nil")
+		assert.True(t, *input.Flags["draft"], "Flags[draft] must be true")
+		assert.DeepEqual(t, []int{1, 2}, input.IDs, "IDs must be parsed from bracketed array")
+		assert.DeepEqual(t, []string{"a,b"}, input.Tags, "Tags must be parsed from bracketed array")
+		assert.Equal(t, 0, len(input.Optional), "Optional must be empty")
+	})
+
+	t.Run("missing required map", func(t *testing.T) {
+		var input mockFilterRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"flags": "true",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+	})
+
+	t.Run("invalid map value", func(t *testing.T) {
+		var input mockFilterRequest
+		err := UnmarshalRequest(
+			events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{
+					"flags[draft]": "true",
+					"range[size]":  "1,ten",
+				},
+			},
+			false,
+			&input,
+		)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(t, "range[size] must be a valid integer", httpErr.Message, "Error message must be correct")
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{
+				"filter[status]": "open",
+				"flags[draft]":   "true",
+				"ids[]":          "3",
+			},
+		}
+
+		var input mockFilterRequest
+		err := UnmarshalRequestWithOptions(req, false, &input, DecoderOptions{Strict: true})
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		req.QueryStringParameters["filter[a][b]"] = "c"
+		req.QueryStringParameters["status[]"] = "open"
+		err = UnmarshalRequestWithOptions(req, false, &input, DecoderOptions{Strict: true})
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError")
+		assert.Equal(
+			t,
+			"unknown query parameter(s): filter[a][b], status[]",
+			httpErr.Message,
+			"Error message must be correct",
+		)
+	})
+}
+
+func Test_UnmarshalRequest_CompressedBody(t *testing.T) {
+	const body = `{"name":"Fake Post","date":"2020-03-23T11:33:00Z"}`
+
+	compress := func(newWriter func(io.Writer) io.WriteCloser) string {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		_, _ = w.Write([]byte(body))
+		_ = w.Close()
+		return buf.String()
+	}
+
+	gzipped := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	zlibbed := compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+	deflated := compress(func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	})
+	brotlied := compress(func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) })
+
+	for name, test := range map[string]struct {
+		encoding string
+		body     string
+		base64   bool
+	}{
+		"gzip":                {"gzip", gzipped, false},
+		"gzip, base64":        {"GZIP", base64.StdEncoding.EncodeToString([]byte(gzipped)), true},
+		"zlib deflate":        {"deflate", zlibbed, false},
+		"raw deflate":         {"deflate", deflated, false},
+		"brotli":              {"br", brotlied, false},
+		"identity":            {"identity", body, false},
+		"multiple encodings":  {"identity, gzip", gzipped, false},
+		"no content encoding": {"", body, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var input mockPostRequest
+			err := UnmarshalRequest(
+				events.APIGatewayProxyRequest{
+					Headers: map[string]string{
+						"content-encoding": test.encoding,
+					},
+					IsBase64Encoded: test.base64,
+					Body:            test.body,
+				},
+				true,
+				&input,
+			)
+			assert.Equal(t, nil, err, "Error must be nil")
+			assert.Equal(t, "Fake Post", input.Name, "Name must be parsed from body")
+		})
+	}
+
+	for name, test := range map[string]struct {
+		encoding string
+		body     string
+		maxSize  int64
+		code     int
+	}{
+		"malformed gzip":       {"gzip", "not gzip", 0, http.StatusBadRequest},
+		"truncated gzip":       {"gzip", gzipped[:len(gzipped)/2], 0, http.StatusBadRequest},
+		"unsupported encoding": {"compress", body, 0, http.StatusUnsupportedMediaType},
+		"too large":            {"gzip", gzipped, 10, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var input mockPostRequest
+			err := UnmarshalRequestWithOptions(
+				events.APIGatewayProxyRequest{
+					Headers: map[string]string{
+						"Content-Encoding": test.encoding,
+					},
+					Body: test.body,
+				},
+				true,
+				&input,
+				DecoderOptions{MaxBodySize: test.maxSize},
+			)
+			assert.NotEqual(t, nil, err, "Error must not be nil")
+			var httpErr HTTPError
+			ok := errors.As(err, &httpErr)
+			assert.True(t, ok, "Error must be an HTTPError")
+			assert.Equal(t, test.code, httpErr.Code, "Error code must be correct")
+		})
+	}
 }
@@ -1,8 +1,10 @@
 package lmdrouter
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -12,28 +14,102 @@ import (
 // be directly returned via the lambda's handler function. It receives an HTTP
 // status code for the response, a map of HTTP headers (can be empty or nil),
 // and a value (probably a struct) representing the response body. This value
-// will be marshaled to JSON (currently without base 64 encoding).
+// will be marshaled to JSON (currently without base 64 encoding). The
+// "Content-Type" header is set to JSON, unless the provided headers already
+// include it. The provided map of headers is not modified. To generate
+// responses in other formats based on the request's "Accept" header, use
+// Negotiate.
 func MarshalResponse(status int, headers map[string]string, data interface{}) (
 	events.APIGatewayProxyResponse,
 	error,
 ) {
-	b, err := json.Marshal(data)
+	return marshalResponse(status, headers, data, jsonEncoder)
+}
+
+func marshalResponse(
+	status int,
+	headers map[string]string,
+	data interface{},
+	enc encoder,
+) (events.APIGatewayProxyResponse, error) {
+	contentType := enc.contentType
+	b, err := enc.encode(data)
 	if err != nil {
 		status = http.StatusInternalServerError
+		contentType = jsonEncoder.contentType
 		b = []byte(`{"code":500,"message":"the server has encountered an unexpected error"}`)
 	}
 
-	if headers == nil {
-		headers = make(map[string]string)
+	resHeaders := make(map[string]string, len(headers)+1)
+	for key, value := range headers {
+		resHeaders[key] = value
+	}
+	if err != nil || !hasHeader(resHeaders, "Content-Type") {
+		resHeaders["Content-Type"] = contentType
 	}
-	headers["Content-Type"] = "application/json; charset=UTF-8"
 
-	return events.APIGatewayProxyResponse{
+	res := events.APIGatewayProxyResponse{
 		StatusCode:      status,
 		IsBase64Encoded: false,
-		Headers:         headers,
+		Headers:         resHeaders,
 		Body:            string(b),
-	}, nil
+	}
+
+	if !isTextContentType(contentType) {
+		res.IsBase64Encoded = true
+		res.Body = base64.StdEncoding.EncodeToString(b)
+	}
+
+	return res, nil
+}
+
+// Binary generates an events.APIGatewayProxyResponse object for a response
+// body made of raw bytes, such as images, PDF documents or ZIP archives. The
+// "Content-Type" header is set to the provided content type. Unless the
+// content type is textual (e.g. "text/plain", or any content type with a
+// charset parameter), the body is base-64 encoded, as required by API Gateway
+// for binary responses. Note that API Gateway REST APIs only decode such
+// responses for content types listed in the API's binary media types.
+func Binary(status int, contentType string, data []byte) (
+	events.APIGatewayProxyResponse,
+	error,
+) {
+	res := events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type": contentType,
+		},
+	}
+
+	if isTextContentType(contentType) {
+		res.Body = string(data)
+	} else {
+		res.IsBase64Encoded = true
+		res.Body = base64.StdEncoding.EncodeToString(data)
+	}
+
+	return res, nil
+}
+
+// Stream is the same as Binary, but reads the response body from a reader.
+// Since API Gateway proxy responses cannot be streamed, the reader is read in
+// its entirety before the response is generated. If the reader is also an
+// io.Closer, it is closed. If reading fails, a 500 Internal Server Error
+// response is generated via HandleError.
+func Stream(status int, contentType string, r io.Reader) (
+	events.APIGatewayProxyResponse,
+	error,
+) {
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close() // nolint: errcheck
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return HandleError(fmt.Errorf("failed reading response body: %w", err))
+	}
+
+	return Binary(status, contentType, data)
 }
 
 // ExposeServerErrors is a boolean indicating whether the HandleError function
@@ -46,7 +122,8 @@ var ExposeServerErrors = true
 // the error. Otherwise, the error is assumed to be 500 Internal Server Error.
 // Regardless, all errors will generate a JSON response in the format
 // `{ "code": 500, "error": "something failed" }`
-// This format cannot currently be changed. If you do not wish to expose server
+// This format cannot currently be changed, except that RequestIDMiddleware
+// adds a "request_id" field to it. If you do not wish to expose server
 // errors (i.e. errors whose status code is 500 or above), set the
 // ExposeServerErrors global variable to false.
 func HandleError(err error) (events.APIGatewayProxyResponse, error) {
@@ -3,6 +3,7 @@ package lmdrouter
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/jgroeneveld/trial/assert"
@@ -52,3 +53,61 @@ func TestHandleError(t *testing.T) {
 		assert.Equal(t, `{"code":500,"message":"Internal Server Error"}`, res.Body, "body must be correct")
 	})
 }
+
+func TestMarshalResponse(t *testing.T) {
+	t.Run("default content type", func(t *testing.T) {
+		res, err := MarshalResponse(http.StatusOK, nil, map[string]string{"id": "bla"})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, `{"id":"bla"}`, res.Body, "body must be correct")
+		assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "content type must be JSON")
+	})
+
+	t.Run("custom content type", func(t *testing.T) {
+		headers := map[string]string{"content-type": "application/problem+json"}
+		res, err := MarshalResponse(http.StatusBadRequest, headers, map[string]string{"id": "bla"})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "application/problem+json", res.Headers["content-type"], "content type must not be overwritten")
+		assert.Equal(t, "", res.Headers["Content-Type"], "content type must not be duplicated")
+		assert.Equal(t, 1, len(headers), "provided headers must not be modified")
+	})
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("disk on fire")
+}
+
+func TestBinary(t *testing.T) {
+	t.Run("binary content type", func(t *testing.T) {
+		res, err := Binary(http.StatusOK, "application/pdf", []byte{0x25, 0x50, 0x44, 0x46, 0x00, 0xff})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be correct")
+		assert.Equal(t, "application/pdf", res.Headers["Content-Type"], "content type must be correct")
+		assert.True(t, res.IsBase64Encoded, "body must be base64 encoded")
+		assert.Equal(t, "JVBERgD/", res.Body, "body must be correct")
+	})
+
+	t.Run("textual content type", func(t *testing.T) {
+		res, err := Binary(http.StatusOK, "text/html; charset=UTF-8", []byte("<p>hi</p>"))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.False(t, res.IsBase64Encoded, "body must not be base64 encoded")
+		assert.Equal(t, "<p>hi</p>", res.Body, "body must be correct")
+	})
+}
+
+func TestStream(t *testing.T) {
+	t.Run("successful read", func(t *testing.T) {
+		res, err := Stream(http.StatusOK, "application/zip", strings.NewReader("PK\x03\x04"))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.True(t, res.IsBase64Encoded, "body must be base64 encoded")
+		assert.Equal(t, "UEsDBA==", res.Body, "body must be correct")
+	})
+
+	t.Run("failed read", func(t *testing.T) {
+		ExposeServerErrors = true
+		res, err := Stream(http.StatusOK, "application/zip", failingReader{})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "status code must be 500")
+	})
+}
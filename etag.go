@@ -0,0 +1,237 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ETagOptions modify the behavior of ETagMiddleware.
+type ETagOptions struct {
+	// Weak causes the middleware to generate weak entity tags (e.g.
+	// `W/"abc"`) instead of strong ones. Weak tags should be used if the
+	// same resource may be represented by different bodies that are
+	// semantically equivalent, e.g. when responses are compressed.
+	Weak bool
+}
+
+// ETag generates an entity tag for a response body, which can be used as the
+// value of an "ETag" header. The tag is derived from a SHA-256 hash of the
+// body. If weak is true, a weak tag is generated.
+func ETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		tag = "W/" + tag
+	}
+
+	return tag
+}
+
+// ETagMiddleware returns a middleware that handles conditional GET and HEAD
+// requests. Successful (200 OK) responses are given an "ETag" header, unless
+// the handler already provided one, generated from the response body (see
+// ETag). If the request's "If-None-Match" header matches the response's
+// entity tag, or if the request does not have an "If-None-Match" header but
+// its "If-Modified-Since" header is not older than the response's
+// "Last-Modified" header (which must be provided by the handler), a 304 Not
+// Modified response with an empty body is returned instead.
+//
+// Note that the handler is still executed for conditional requests, so the
+// middleware saves bandwidth rather than computation. Requests of other
+// methods, as well as streamed responses (see StreamResponse), are not
+// modified; for optimistic concurrency with PUT and PATCH requests, handlers
+// should use CheckPreconditions.
+func ETagMiddleware(opts ETagOptions) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			res, err = next(ctx, req)
+			if err != nil || res.StatusCode != http.StatusOK || isStreamed(ctx) ||
+				(req.HTTPMethod != http.MethodGet && req.HTTPMethod != http.MethodHead) {
+				return res, err
+			}
+
+			etag := headerValue(res.Headers, "ETag")
+			if etag == "" {
+				body := []byte(res.Body)
+				if res.IsBase64Encoded {
+					body, err = base64.StdEncoding.DecodeString(res.Body)
+					if err != nil {
+						return res, nil
+					}
+				}
+
+				etag = ETag(body, opts.Weak)
+
+				headers := make(map[string]string, len(res.Headers)+1)
+				for key, value := range res.Headers {
+					headers[key] = value
+				}
+				headers["ETag"] = etag
+				res.Headers = headers
+			}
+
+			if !notModified(req, etag, headerValue(res.Headers, "Last-Modified")) {
+				return res, nil
+			}
+
+			return notModifiedResponse(res), nil
+		}
+	}
+}
+
+// notModified returns true if a conditional GET or HEAD request should be
+// answered with 304 Not Modified.
+func notModified(
+	req events.APIGatewayProxyRequest,
+	etag string,
+	lastModified string,
+) bool {
+	if ifNoneMatch := headerValue(req.Headers, "If-None-Match"); ifNoneMatch != "" {
+		return etagListMatches(ifNoneMatch, etag, false)
+	}
+
+	ifModifiedSince := headerValue(req.Headers, "If-Modified-Since")
+	if ifModifiedSince == "" || lastModified == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// notModifiedHeaders are the headers of a response that are kept when it is
+// converted into a 304 Not Modified response.
+var notModifiedHeaders = []string{
+	"Cache-Control",
+	"Content-Location",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+func notModifiedResponse(
+	res events.APIGatewayProxyResponse,
+) events.APIGatewayProxyResponse {
+	headers := make(map[string]string)
+	for key, value := range res.Headers {
+		for _, keep := range notModifiedHeaders {
+			if strings.EqualFold(key, keep) {
+				headers[key] = value
+				break
+			}
+		}
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusNotModified,
+		Headers:    headers,
+	}
+}
+
+// CheckPreconditions evaluates the "If-Match" and "If-Unmodified-Since"
+// headers of a request (usually PUT, PATCH or DELETE) against the current
+// entity tag and modification time of the resource it modifies, allowing
+// handlers to implement optimistic concurrency. If a precondition fails, a 412
+// Precondition Failed HTTPError is returned, which should be passed to
+// HandleError. Pass an empty etag if the resource does not exist, and a zero
+// lastModified if the modification time is unknown.
+//
+// Example:
+//
+//     post, err := loadPost(ctx, input.ID)
+//     if err != nil {
+//         return lmdrouter.HandleError(err)
+//     }
+//
+//     err = lmdrouter.CheckPreconditions(req, post.ETag(), post.UpdatedAt)
+//     if err != nil {
+//         return lmdrouter.HandleError(err)
+//     }
+//
+func CheckPreconditions(
+	req events.APIGatewayProxyRequest,
+	etag string,
+	lastModified time.Time,
+) error {
+	if ifMatch := headerValue(req.Headers, "If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, true) {
+			return preconditionFailedError()
+		}
+		return nil
+	}
+
+	ifUnmodifiedSince := headerValue(req.Headers, "If-Unmodified-Since")
+	if ifUnmodifiedSince == "" || lastModified.IsZero() {
+		return nil
+	}
+
+	since, err := http.ParseTime(ifUnmodifiedSince)
+	if err != nil {
+		return nil
+	}
+
+	if lastModified.Truncate(time.Second).After(since) {
+		return preconditionFailedError()
+	}
+
+	return nil
+}
+
+func preconditionFailedError() error {
+	return HTTPError{
+		Code:    http.StatusPreconditionFailed,
+		Message: "Precondition failed",
+	}
+}
+
+// etagListMatches checks if the value of an "If-Match" or "If-None-Match"
+// header matches an entity tag. The value "*" matches any existing entity.
+// If strong is true, the strong comparison function is used, meaning weak
+// tags never match. Otherwise, the weak comparison function is used.
+func etagListMatches(list, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
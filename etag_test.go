@@ -0,0 +1,151 @@
+package lmdrouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestETag(t *testing.T) {
+	strong := ETag([]byte(`{"id":"bla"}`), false)
+	weak := ETag([]byte(`{"id":"bla"}`), true)
+	assert.True(t, len(strong) == 34, "strong tag must be a quoted hash")
+	assert.Equal(t, "W/"+strong, weak, "weak tag must be prefixed with W/")
+	assert.NotEqual(t, strong, ETag([]byte(`{"id":"bla2"}`), false), "tags must differ for different bodies")
+}
+
+func TestETagMiddleware(t *testing.T) {
+	lastModified := time.Date(2021, 11, 1, 11, 11, 11, 0, time.UTC)
+
+	lmd := NewRouter("/api", ETagMiddleware(ETagOptions{}))
+	lmd.Route("GET", "/", func(_ context.Context, _ events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		return MarshalResponse(http.StatusOK, map[string]string{
+			"Cache-Control": "max-age=60",
+			"Last-Modified": lastModified.Format(http.TimeFormat),
+		}, map[string]string{"id": "bla"})
+	})
+	lmd.Route("GET", "/:id", func(_ context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		if req.PathParameters["id"] == "missing" {
+			return HandleError(HTTPError{http.StatusNotFound, "No such item"})
+		}
+		return MarshalResponse(http.StatusOK, map[string]string{
+			"ETag": `"v2"`,
+		}, map[string]string{"id": req.PathParameters["id"]})
+	})
+
+	get := func(path string, headers map[string]string) events.APIGatewayProxyResponse {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       path,
+			Headers:    headers,
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		return res
+	}
+
+	etag := ETag([]byte(`{"id":"bla"}`), false)
+
+	t.Run("unconditional request", func(t *testing.T) {
+		res := get("/api", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+		assert.Equal(t, etag, res.Headers["ETag"], "ETag must be generated")
+		assert.Equal(t, `{"id":"bla"}`, res.Body, "body must be correct")
+	})
+
+	t.Run("matching If-None-Match", func(t *testing.T) {
+		res := get("/api", map[string]string{"if-none-match": `"other", W/` + etag})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, "status code must be 304")
+		assert.Equal(t, "", res.Body, "body must be empty")
+		assert.Equal(t, etag, res.Headers["ETag"], "ETag must be kept")
+		assert.Equal(t, "max-age=60", res.Headers["Cache-Control"], "Cache-Control must be kept")
+		assert.Equal(t, "", res.Headers["Content-Type"], "Content-Type must be removed")
+	})
+
+	t.Run("non-matching If-None-Match", func(t *testing.T) {
+		res := get("/api", map[string]string{
+			"If-None-Match":     `"other"`,
+			"If-Modified-Since": lastModified.Format(http.TimeFormat),
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		res := get("/api", map[string]string{
+			"If-Modified-Since": lastModified.Add(time.Hour).Format(http.TimeFormat),
+		})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, "status code must be 304")
+
+		res = get("/api", map[string]string{
+			"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat),
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+	})
+
+	t.Run("handler-provided ETag", func(t *testing.T) {
+		res := get("/api/bla", nil)
+		assert.Equal(t, `"v2"`, res.Headers["ETag"], "ETag must not be replaced")
+
+		res = get("/api/bla", map[string]string{"If-None-Match": `"v2"`})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, "status code must be 304")
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		res := get("/api/missing", map[string]string{"If-None-Match": "*"})
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "status code must be 404")
+		assert.Equal(t, "", res.Headers["ETag"], "ETag must not be generated")
+	})
+
+	t.Run("weak tags", func(t *testing.T) {
+		handler := ETagMiddleware(ETagOptions{Weak: true})(lmd.routes["/"].methods["GET"].handler)
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET"})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "W/"+etag, res.Headers["ETag"], "ETag must be weak")
+	})
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	lastModified := time.Date(2021, 11, 1, 11, 11, 11, 0, time.UTC)
+
+	for name, test := range map[string]struct {
+		headers      map[string]string
+		etag         string
+		lastModified time.Time
+		ok           bool
+	}{
+		"no preconditions":            {nil, `"v1"`, lastModified, true},
+		"matching If-Match":           {map[string]string{"If-Match": `"v0", "v1"`}, `"v1"`, lastModified, true},
+		"non-matching If-Match":       {map[string]string{"If-Match": `"v0"`}, `"v1"`, lastModified, false},
+		"weak If-Match":               {map[string]string{"if-match": `W/"v1"`}, `"v1"`, lastModified, false},
+		"wildcard If-Match":           {map[string]string{"If-Match": "*"}, `"v1"`, lastModified, true},
+		"wildcard, no resource":       {map[string]string{"If-Match": "*"}, "", time.Time{}, false},
+		"If-Unmodified-Since":         {map[string]string{"If-Unmodified-Since": lastModified.Format(http.TimeFormat)}, `"v1"`, lastModified, true},
+		"modified since":              {map[string]string{"If-Unmodified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)}, `"v1"`, lastModified, false},
+		"If-Match over If-Unmodified": {map[string]string{"If-Match": `"v1"`, "If-Unmodified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)}, `"v1"`, lastModified, true},
+	} {
+		err := CheckPreconditions(
+			events.APIGatewayProxyRequest{HTTPMethod: "PUT", Headers: test.headers},
+			test.etag,
+			test.lastModified,
+		)
+		if test.ok {
+			assert.Equal(t, nil, err, "Error must be nil for "+name)
+			continue
+		}
+
+		var httpErr HTTPError
+		ok := errors.As(err, &httpErr)
+		assert.True(t, ok, "Error must be an HTTPError for "+name)
+		assert.Equal(t, http.StatusPreconditionFailed, httpErr.Code, "Error code must be 412 for "+name)
+	}
+}
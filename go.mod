@@ -1,10 +1,25 @@
 module github.com/aquasecurity/lmdrouter
 
-go 1.14
+go 1.21
 
 require (
-	github.com/aws/aws-lambda-go v1.15.0
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/jgroeneveld/schema v1.0.0 // indirect
+	github.com/andybalholm/brotli v1.0.5
+	github.com/aws/aws-lambda-go v1.47.0
 	github.com/jgroeneveld/trial v2.0.0+incompatible
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.opentelemetry.io/contrib/propagators/aws v1.29.0
+	go.opentelemetry.io/otel v1.29.0
+	go.opentelemetry.io/otel/sdk v1.29.0
+	go.opentelemetry.io/otel/trace v1.29.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/jgroeneveld/schema v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	go.opentelemetry.io/otel/metric v1.29.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
 )
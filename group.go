@@ -0,0 +1,60 @@
+package lmdrouter
+
+// Group is a set of routes that share a common path prefix and a list of
+// middleware functions, which are executed after the router's global
+// middleware and before the middleware of every route. Groups are created
+// with the Group method of Router, and may be nested.
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter("/api", loggerMiddleware)
+//
+//     admin := router.Group("/admin", authMiddleware, lmdrouter.HeadersMiddleware(
+//         lmdrouter.HeaderPolicy{CacheControl: "no-store"},
+//     ))
+//     admin.Route("GET", "/users", listUsers)
+//     admin.Route("DELETE", "/users/:id", deleteUser)
+//
+type Group struct {
+	router *Router
+	prefix string
+	hasMiddleware
+}
+
+// Group creates a new group of routes with a path prefix (relative to the
+// router's base path) and zero or more middleware functions.
+func (l *Router) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{
+		router: l,
+		prefix: prefix,
+		hasMiddleware: hasMiddleware{
+			middleware: middleware,
+		},
+	}
+}
+
+// Group creates a nested group of routes, whose path prefix is relative to
+// the prefix of the parent group, and whose middleware is executed after the
+// middleware of the parent group.
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{
+		router: g.router,
+		prefix: g.prefix + prefix,
+		hasMiddleware: hasMiddleware{
+			middleware: g.chain(middleware),
+		},
+	}
+}
+
+// Route registers a new route in the group's router, with the provided HTTP
+// method name and path (relative to the group's prefix), and zero or more
+// local middleware functions.
+func (g *Group) Route(method, path string, handler Handler, middleware ...Middleware) {
+	g.router.Route(method, g.prefix+path, handler, g.chain(middleware)...)
+}
+
+func (g *Group) chain(middleware []Middleware) []Middleware {
+	chain := make([]Middleware, 0, len(g.middleware)+len(middleware))
+	chain = append(chain, g.middleware...)
+	return append(chain, middleware...)
+}
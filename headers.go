@@ -0,0 +1,67 @@
+package lmdrouter
+
+import "strings"
+
+// headerValue returns the value of a header from a map of headers, looking up
+// the header name in a case-insensitive way. This is necessary since API
+// Gateway does not normalize header names, and HTTP/2 clients send them in
+// lowercase.
+func headerValue(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// hasHeader returns true if a map of headers includes a header, looking up
+// the header name in a case-insensitive way.
+func hasHeader(headers map[string]string, name string) bool {
+	if _, ok := headers[name]; ok {
+		return true
+	}
+
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasMultiValueHeader returns true if a map of multi-value headers includes
+// a header, looking up the header name in a case-insensitive way.
+func hasMultiValueHeader(headers map[string][]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headerParams returns a map with the header of the provided name, looked up
+// in a case-insensitive way but keyed by that name, so that header values can
+// be bound like other request parameters. It returns nil if the header does
+// not exist.
+func headerParams[V any](headers map[string]V, name string) map[string]V {
+	if value, ok := headers[name]; ok {
+		return map[string]V{name: value}
+	}
+
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return map[string]V{name: value}
+		}
+	}
+
+	return nil
+}
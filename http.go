@@ -12,7 +12,8 @@ import (
 
 // ServerHTTP implements the net/http.Handler interface in order to allow
 // lmdrouter applications to be used outside of AWS Lambda environments, most
-// likely for local development purposes
+// likely for local development purposes. Responses generated by StreamResponse
+// and StreamJSON are written in chunks as they are generated.
 func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// convert request into an events.APIGatewayProxyRequest object
 	singleValueHeaders := convertMap(map[string][]string(r.Header))
@@ -40,7 +41,9 @@ func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Body:                            string(body),
 	}
 
-	res, err := l.Handler(r.Context(), event)
+	ctx, slot := withStreaming(r.Context())
+
+	res, err := l.Handler(ctx, event)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(500)
@@ -50,6 +53,13 @@ func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if slot.body != nil {
+		writeHeaders(w, res)
+		w.WriteHeader(res.StatusCode)
+		writeStream(w, slot.body)
+		return
+	}
+
 	var resBody []byte
 	if res.IsBase64Encoded {
 		resBody, err = base64.StdEncoding.DecodeString(res.Body)
@@ -65,6 +75,12 @@ func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		resBody = []byte(res.Body)
 	}
 
+	writeHeaders(w, res)
+	w.WriteHeader(res.StatusCode)
+	w.Write(resBody) // nolint: errcheck
+}
+
+func writeHeaders(w http.ResponseWriter, res events.APIGatewayProxyResponse) {
 	for header, values := range res.MultiValueHeaders {
 		for i, value := range values {
 			if i == 0 {
@@ -80,9 +96,33 @@ func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set(header, value)
 		}
 	}
+}
 
-	w.WriteHeader(res.StatusCode)
-	w.Write(resBody) // nolint: errcheck
+// writeStream copies a streamed response body to the response writer,
+// flushing after every read so that the client receives data as soon as it
+// is generated. Since the status code was already written, errors can only
+// be signaled by ending the response early.
+func writeStream(w http.ResponseWriter, body io.Reader) {
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close() // nolint: errcheck
+	}
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
 }
 
 func convertMap(in map[string][]string) map[string]string {
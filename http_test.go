@@ -1,12 +1,17 @@
 package lmdrouter
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/jgroeneveld/trial/assert"
 )
 
@@ -17,6 +22,8 @@ func TestHTTPHandler(t *testing.T) {
 	lmd.Route("GET", "/:id", getSomething)
 	lmd.Route("GET", "/:id/stuff", listStuff)
 	lmd.Route("GET", "/:id/stuff/:fake", listStuff)
+	lmd.Route("GET", "/files/image", getImage)
+	lmd.Route("POST", "/files/echo", echoFile)
 
 	ts := httptest.NewServer(http.HandlerFunc(lmd.ServeHTTP))
 
@@ -96,4 +103,54 @@ func TestHTTPHandler(t *testing.T) {
 			"Response body must match",
 		)
 	})
+	t.Run("GET /api/files/image", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/api/files/image")
+		assert.Equal(t, nil, err, "Response error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "image/png", res.Header.Get("Content-Type"), "Content type must be correct")
+
+		body, err := io.ReadAll(res.Body)
+		assert.Equal(t, nil, err, "Read error must be nil")
+		assert.DeepEqual(t, mockImage, body, "Body must match")
+	})
+
+	t.Run("POST /api/files/echo", func(t *testing.T) {
+		data := make([]byte, 256)
+		for i := range data {
+			data[i] = byte(i)
+		}
+
+		res, err := http.Post(
+			ts.URL+"/api/files/echo",
+			"application/octet-stream",
+			bytes.NewReader(data),
+		)
+		assert.Equal(t, nil, err, "Response error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "application/octet-stream", res.Header.Get("Content-Type"), "Content type must be correct")
+
+		body, err := io.ReadAll(res.Body)
+		assert.Equal(t, nil, err, "Read error must be nil")
+		assert.DeepEqual(t, data, body, "Body must match")
+	})
+}
+
+var mockImage = []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0xff}
+
+func getImage(ctx context.Context, req events.APIGatewayProxyRequest) (
+	res events.APIGatewayProxyResponse,
+	err error,
+) {
+	return Binary(http.StatusOK, "image/png", mockImage)
+}
+
+func echoFile(ctx context.Context, req events.APIGatewayProxyRequest) (
+	res events.APIGatewayProxyResponse,
+	err error,
+) {
+	return Stream(
+		http.StatusOK,
+		req.Headers["Content-Type"],
+		strings.NewReader(req.Body),
+	)
 }
@@ -0,0 +1,576 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// JWTOptions modify the behavior of JWTMiddleware. At least one of Keys and
+// JWKSURL must be provided.
+type JWTOptions struct {
+	// Keys are static verification keys, indexed by key ID (the "kid" header
+	// of tokens). The key with an empty ID is used for tokens without a key
+	// ID. Keys must be of type []byte for HMAC algorithms (HS256, HS384 and
+	// HS512), *rsa.PublicKey for RSA algorithms (RS256, RS384, RS512, PS256,
+	// PS384 and PS512), and *ecdsa.PublicKey for ECDSA algorithms (ES256,
+	// ES384 and ES512).
+	Keys map[string]interface{}
+
+	// JWKSURL is the URL of a JSON Web Key Set document with verification
+	// keys, e.g. "https://<domain>/.well-known/jwks.json". The document is
+	// cached, and fetched again when it expires, or when a token references
+	// an unknown key ID (at most once per minute). If fetching the document
+	// fails, the previously fetched keys are used until a fetch succeeds.
+	// Only RSA and EC keys are taken from the document; since it is public,
+	// symmetric ("oct") keys are ignored, and HMAC secrets must be provided
+	// in Keys.
+	JWKSURL string
+
+	// JWKSCacheTTL is the duration for which the JWKS document is cached. If
+	// zero, one hour is used.
+	JWKSCacheTTL time.Duration
+
+	// HTTPClient is the client used to fetch the JWKS document. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Algorithms are the accepted signature algorithms. If empty, all
+	// supported algorithms are accepted. Regardless, the algorithm of a token
+	// must match the type of the key it is verified with.
+	Algorithms []string
+
+	// Issuer is the required value of the "iss" claim. If empty, the claim is
+	// not checked.
+	Issuer string
+
+	// Audience is the value that the "aud" claim must include. If empty, the
+	// claim is not checked.
+	Audience string
+
+	// Leeway is the clock skew tolerated when checking the "exp" and "nbf"
+	// claims.
+	Leeway time.Duration
+}
+
+// Claims are the claims of a verified JSON Web Token.
+type Claims map[string]interface{}
+
+// Subject returns the value of the "sub" claim.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Audience returns the value of the "aud" claim, which may either be a
+// single string or a list of strings.
+func (c Claims) Audience() []string {
+	if aud, ok := c["aud"].(string); ok {
+		return []string{aud}
+	}
+
+	return claimList(c["aud"])
+}
+
+type jwtClaimsKey struct{}
+
+// JWTClaims returns the claims of the token verified by JWTMiddleware for the
+// request with the provided context, if any.
+func JWTClaims(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(jwtClaimsKey{}).(Claims)
+	return claims, ok
+}
+
+// JWTMiddleware returns a middleware that authenticates requests with bearer
+// JSON Web Tokens, such as those issued by Amazon Cognito or Auth0, for APIs
+// that do not use an API Gateway authorizer. The token is taken from the
+// request's "Authorization" header, its signature is verified with the
+// static keys or JWKS document provided in the options, and its "exp", "nbf",
+// "iss" and "aud" claims are checked. The claims of valid tokens are stored in
+// the request's context, and can be retrieved with JWTClaims. A Principal is
+// also stored, with the scopes taken from the "scope" or "scp" claim, and the
+// roles taken from the "roles" or "cognito:groups" claim.
+//
+// Requests without a valid token are rejected with a 401 Unauthorized error
+// response, generated by the router's error handler, with a
+// "WWW-Authenticate" header. Failures to fetch the JWKS document generate a
+// 500 Internal Server Error response.
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter("/api", lmdrouter.JWTMiddleware(
+//         lmdrouter.JWTOptions{
+//             JWKSURL:  "https://example.auth0.com/.well-known/jwks.json",
+//             Issuer:   "https://example.auth0.com/",
+//             Audience: "https://api.example.com",
+//         },
+//     ))
+//
+func JWTMiddleware(opts JWTOptions) Middleware {
+	var jwks *jwksCache
+	if opts.JWKSURL != "" {
+		jwks = &jwksCache{
+			url:    opts.JWKSURL,
+			ttl:    opts.JWKSCacheTTL,
+			client: opts.HTTPClient,
+		}
+		if jwks.ttl == 0 {
+			jwks.ttl = time.Hour
+		}
+		if jwks.client == nil {
+			jwks.client = http.DefaultClient
+		}
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			token, ok := bearerToken(req)
+			if !ok {
+				return unauthorized(ctx, `Bearer`, "missing bearer token")
+			}
+
+			claims, err := verifyJWT(ctx, token, opts, jwks)
+			if err != nil {
+				var httpErr HTTPError
+				if errors.As(err, &httpErr) {
+					return unauthorized(
+						ctx,
+						`Bearer error="invalid_token"`,
+						httpErr.Message,
+					)
+				}
+				return routerFromContext(ctx).handleError(err)
+			}
+
+			ctx = context.WithValue(ctx, jwtClaimsKey{}, claims)
+			ctx = WithPrincipal(ctx, principalFromClaims(claims))
+			return next(ctx, req)
+		}
+	}
+}
+
+// bearerToken returns the token from the request's "Authorization" header,
+// if it uses the Bearer scheme.
+func bearerToken(req events.APIGatewayProxyRequest) (string, bool) {
+	auth := headerValue(req.Headers, "Authorization")
+
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
+
+// unauthorized generates a 401 Unauthorized error response via the router's
+// error handler, with a "WWW-Authenticate" header including the provided
+// challenge.
+func unauthorized(ctx context.Context, challenge, message string) (
+	events.APIGatewayProxyResponse,
+	error,
+) {
+	res, err := routerFromContext(ctx).handleError(HTTPError{
+		Code:    http.StatusUnauthorized,
+		Message: message,
+	})
+	if res.Headers == nil {
+		res.Headers = make(map[string]string)
+	}
+	res.Headers["WWW-Authenticate"] = challenge
+
+	return res, err
+}
+
+func invalidTokenError(message string) error {
+	return HTTPError{
+		Code:    http.StatusUnauthorized,
+		Message: message,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verifyJWT verifies the signature and claims of a token. Invalid tokens are
+// reported as 401 HTTPErrors, other errors (such as failures to fetch the
+// JWKS document) are returned as is.
+func verifyJWT(
+	ctx context.Context,
+	token string,
+	opts JWTOptions,
+	jwks *jwksCache,
+) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidTokenError("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, invalidTokenError("malformed token header")
+	}
+
+	if !jwtAlgorithmAllowed(header.Alg, opts.Algorithms) {
+		return nil, invalidTokenError("unsupported token algorithm")
+	}
+
+	key, ok := opts.Keys[header.Kid]
+	if !ok {
+		if jwks == nil {
+			return nil, invalidTokenError("unknown token key")
+		}
+
+		var err error
+		key, ok, err = jwks.key(ctx, header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, invalidTokenError("unknown token key")
+		}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidTokenError("malformed token signature")
+	}
+
+	err = verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return nil, invalidTokenError("invalid token signature")
+	}
+
+	var claims Claims
+	if err = decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, invalidTokenError("malformed token claims")
+	}
+
+	if err = checkJWTClaims(claims, opts); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func decodeJWTSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+var jwtCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+func jwtAlgorithmAllowed(alg string, allowed []string) bool {
+	if len(alg) != 5 {
+		return false
+	}
+
+	switch alg[:2] {
+	case "HS", "RS", "PS", "ES":
+	default:
+		return false
+	}
+
+	if _, ok := jwtHashes[alg[2:]]; !ok {
+		return false
+	}
+
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyJWTSignature verifies the signature of a token's signing input with
+// a key, which must be of the type matching the algorithm.
+func verifyJWTSignature(alg string, key interface{}, input string, signature []byte) error {
+	hash := jwtHashes[alg[2:]]
+	h := hash.New()
+	h.Write([]byte(input)) // nolint: errcheck
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return errors.New("key type mismatch")
+		}
+
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(input)) // nolint: errcheck
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type mismatch")
+		}
+
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("key type mismatch")
+		}
+
+		if pub.Curve != jwtCurves[alg] {
+			return errors.New("key curve mismatch")
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("signature size mismatch")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+
+	return errors.New("unsupported algorithm")
+}
+
+func checkJWTClaims(claims Claims, opts JWTOptions) error {
+	now := time.Now()
+
+	if exp, ok := claims["exp"]; ok {
+		t, ok := exp.(float64)
+		if !ok {
+			return invalidTokenError("malformed exp claim")
+		}
+		if now.After(time.Unix(int64(t), 0).Add(opts.Leeway)) {
+			return invalidTokenError("token has expired")
+		}
+	}
+
+	if nbf, ok := claims["nbf"]; ok {
+		t, ok := nbf.(float64)
+		if !ok {
+			return invalidTokenError("malformed nbf claim")
+		}
+		if now.Add(opts.Leeway).Before(time.Unix(int64(t), 0)) {
+			return invalidTokenError("token is not valid yet")
+		}
+	}
+
+	if opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != opts.Issuer {
+			return invalidTokenError("invalid token issuer")
+		}
+	}
+
+	if opts.Audience != "" {
+		found := false
+		for _, aud := range claims.Audience() {
+			if aud == opts.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalidTokenError("invalid token audience")
+		}
+	}
+
+	return nil
+}
+
+// jwksCache fetches and caches the keys of a JSON Web Key Set document.
+type jwksCache struct {
+	sync.Mutex
+	url     string
+	ttl     time.Duration
+	client  *http.Client
+	keys    map[string]interface{}
+	fetched time.Time
+	failed  time.Time
+}
+
+// jwksMinRefreshInterval is the minimum time between fetches of the JWKS
+// document triggered by unknown key IDs, which prevents clients from forcing
+// a fetch on every request.
+const jwksMinRefreshInterval = time.Minute
+
+// key returns the key with the provided ID, fetching the JWKS document if
+// it was not fetched yet, if it expired, or if the key is unknown and the
+// document was not fetched recently. If fetching the document fails after it
+// was fetched before, the stale keys are used, and the document is not
+// fetched again for a minute.
+func (c *jwksCache) key(ctx context.Context, kid string) (interface{}, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	age := time.Since(c.fetched)
+	key, ok := c.keys[kid]
+	if c.keys != nil && age < c.ttl && (ok || age < jwksMinRefreshInterval) {
+		return key, ok, nil
+	}
+	if c.keys != nil && time.Since(c.failed) < jwksMinRefreshInterval {
+		return key, ok, nil
+	}
+
+	err := c.fetch(ctx)
+	if err != nil {
+		if c.keys != nil {
+			c.failed = time.Now()
+			return key, ok, nil
+		}
+		return nil, false, err
+	}
+
+	key, ok = c.keys[kid]
+	return key, ok, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (c *jwksCache) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating JWKS request: %w", err)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed fetching JWKS: %w", err)
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed fetching JWKS: server returned %s", res.Status)
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("failed parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// keys of unsupported types are ignored
+		key, err := jwk.publicKey()
+		if err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	c.keys = keys
+	c.fetched = time.Now()
+
+	return nil
+}
+
+// publicKey converts a JSON Web Key into a verification key of the type
+// expected by verifyJWTSignature. Only public (RSA and EC) keys are
+// supported.
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
@@ -0,0 +1,261 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestJWTMiddleware(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err, "RSA key generation must succeed")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err, "ECDSA key generation must succeed")
+	secret := []byte("s3cr3t")
+
+	// local stand-in for an identity provider's JWKS endpoint
+	var jwksRequests int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&jwksRequests, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa-1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": "ec-1",
+					"crv": "P-256",
+					"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+					"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+				{
+					"kty": "oct",
+					"kid": "oct-1",
+					"k":   base64.RawURLEncoding.EncodeToString(secret),
+				},
+			},
+		})
+	}))
+	defer jwksServer.Close()
+
+	lmd := NewRouter("/api", JWTMiddleware(JWTOptions{
+		Keys:     map[string]interface{}{"hmac-1": secret},
+		JWKSURL:  jwksServer.URL,
+		Issuer:   "https://issuer.example.com/",
+		Audience: "my-api",
+	}))
+	lmd.Route("GET", "/me", func(ctx context.Context, _ events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		claims, ok := JWTClaims(ctx)
+		if !ok {
+			return HandleError(HTTPError{http.StatusInternalServerError, "no claims"})
+		}
+		return MarshalResponse(http.StatusOK, nil, map[string]string{"sub": claims.Subject()})
+	})
+
+	call := func(authorization string) events.APIGatewayProxyResponse {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/me",
+			Headers:    map[string]string{"authorization": authorization},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		return res
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "user-1",
+			"iss": "https://issuer.example.com/",
+			"aud": []string{"other-api", "my-api"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"nbf": time.Now().Add(-time.Minute).Unix(),
+		}
+	}
+
+	for name, token := range map[string]string{
+		"RS256 via JWKS": signTestJWT(t, "RS256", "rsa-1", rsaKey, validClaims()),
+		"PS384 via JWKS": signTestJWT(t, "PS384", "rsa-1", rsaKey, validClaims()),
+		"ES256 via JWKS": signTestJWT(t, "ES256", "ec-1", ecKey, validClaims()),
+		"HS256 static":   signTestJWT(t, "HS256", "hmac-1", secret, validClaims()),
+	} {
+		res := call("Bearer " + token)
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200 for "+name)
+		assert.Equal(t, `{"sub":"user-1"}`, res.Body, "Claims must be available for "+name)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&jwksRequests), "JWKS must be cached")
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	notYetValid := validClaims()
+	notYetValid["nbf"] = time.Now().Add(time.Hour).Unix()
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://evil.example.com/"
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "other-api"
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	valid := signTestJWT(t, "RS256", "rsa-1", rsaKey, validClaims())
+	parts := strings.Split(valid, ".")
+
+	for name, authorization := range map[string]string{
+		"missing header":   "",
+		"basic auth":       "Basic dXNlcm5hbWU6cGFzc3BocmFzZQ==",
+		"malformed token":  "Bearer bla",
+		"expired":          "Bearer " + signTestJWT(t, "RS256", "rsa-1", rsaKey, expired),
+		"not yet valid":    "Bearer " + signTestJWT(t, "RS256", "rsa-1", rsaKey, notYetValid),
+		"wrong issuer":     "Bearer " + signTestJWT(t, "RS256", "rsa-1", rsaKey, wrongIssuer),
+		"wrong audience":   "Bearer " + signTestJWT(t, "RS256", "rsa-1", rsaKey, wrongAudience),
+		"wrong key":        "Bearer " + signTestJWT(t, "RS256", "rsa-1", otherKey, validClaims()),
+		"unknown key":      "Bearer " + signTestJWT(t, "RS256", "rsa-2", rsaKey, validClaims()),
+		"tampered claims":  "Bearer " + parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2],
+		"alg none":         "Bearer " + signTestJWT(t, "none", "rsa-1", nil, validClaims()),
+		"algorithm switch": "Bearer " + signTestJWT(t, "HS256", "rsa-1", rsaKey.N.Bytes(), validClaims()),
+		"symmetric JWKS":   "Bearer " + signTestJWT(t, "HS256", "oct-1", secret, validClaims()),
+	} {
+		res := call(authorization)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "Status code must be 401 for "+name)
+		assert.True(
+			t,
+			strings.HasPrefix(res.Headers["WWW-Authenticate"], "Bearer"),
+			"WWW-Authenticate header must be set for "+name,
+		)
+	}
+
+	assert.Equal(
+		t,
+		int32(1),
+		atomic.LoadInt32(&jwksRequests),
+		"JWKS must not be refetched for unknown keys right after being fetched",
+	)
+}
+
+func TestJWTMiddlewareJWKSFailure(t *testing.T) {
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer jwksServer.Close()
+
+	handler := JWTMiddleware(JWTOptions{JWKSURL: jwksServer.URL})(getSomething)
+	res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{
+			"Authorization": "Bearer " + signTestJWT(t, "HS256", "hmac-1", []byte("bla"), map[string]interface{}{}),
+		},
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "Status code must be 500")
+}
+
+func TestJWTMiddlewareStaleJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err, "RSA key generation must succeed")
+
+	var jwksRequests int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&jwksRequests, 1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa-1",
+					"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+			},
+		})
+	}))
+	defer jwksServer.Close()
+
+	handler := JWTMiddleware(JWTOptions{
+		JWKSURL:      jwksServer.URL,
+		JWKSCacheTTL: time.Millisecond,
+	})(getSomething)
+	token := signTestJWT(t, "RS256", "rsa-1", rsaKey, map[string]interface{}{"sub": "user-1"})
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(2 * time.Millisecond)
+
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Stale keys must be used when refreshing fails")
+	}
+
+	assert.Equal(
+		t,
+		int32(2),
+		atomic.LoadInt32(&jwksRequests),
+		"JWKS must not be refetched right after a failed fetch",
+	)
+}
+
+// signTestJWT generates a signed JSON Web Token for tests.
+func signTestJWT(
+	t *testing.T,
+	alg, kid string,
+	key interface{},
+	claims map[string]interface{},
+) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+	var signature []byte
+	switch {
+	case alg == "none":
+	case strings.HasPrefix(alg, "HS"):
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		h := hashes[alg[2:]].New()
+		h.Write([]byte(input))
+
+		var err error
+		if strings.HasPrefix(alg, "PS") {
+			signature, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hashes[alg[2:]], h.Sum(nil), nil)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hashes[alg[2:]], h.Sum(nil))
+		}
+		assert.Equal(t, nil, err, "Signing must succeed")
+	case strings.HasPrefix(alg, "ES"):
+		digest := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		assert.Equal(t, nil, err, "Signing must succeed")
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
@@ -40,7 +40,12 @@
 //
 // * Supports all HTTP methods.
 //
-// * Supports middleware functions at a global and per-resource level.
+// * Supports middleware functions at a global, per-group and per-resource
+// level.
+//
+// * Supports declarative header policies (e.g. Cache-Control and security
+// headers) at a global, per-group and per-resource level. See the
+// HeaderPolicy type for more information.
 //
 // * Supports path parameters with a simple ":<name>" format (e.g. "/posts/:id").
 //
@@ -51,8 +56,23 @@
 // more information.
 //
 // * Provides the ability to automatically "marshal" responses of any type to an
-// API Gateway response (only JSON responses are currently generated). See the
-// MarshalResponse function for more information.
+// API Gateway response, either as JSON or in a format negotiated from the
+// request's "Accept" header (JSON, XML, YAML, CSV, MessagePack, plain text or
+// any custom format). See the MarshalResponse and Negotiate functions for more
+// information.
+//
+// * Provides the ability to write handlers as functions of a typed input and
+// output via the generic Typed function, which binds the input from the
+// request and marshals the output automatically.
+//
+// * Supports streaming large collections as JSON arrays or newline-delimited
+// JSON, via Lambda response streaming through function URLs, or chunked writes
+// when running locally. See the StreamJSON and StreamingHandler functions for
+// more information.
+//
+// * Provides OpenTelemetry tracing via the TracingMiddleware function, which
+// starts a server span per request, named after the matched route, and
+// continues W3C Trace Context or AWS X-Ray traces.
 //
 // * Implements net/http.Handler for local development and general usage outside
 // of an AWS Lambda environment.
@@ -78,6 +98,29 @@ type hasMiddleware struct {
 // and it's Handler method is used by the lambda to match requests and execute
 // the appropriate handler.
 type Router struct {
+	// DecoderOptions are the options used by the router's UnmarshalRequest
+	// method. They can be modified after the router is created, but should
+	// not be modified while the router is handling requests.
+	DecoderOptions DecoderOptions
+
+	// ErrorHandler generates responses for errors encountered by the router
+	// itself (e.g. when no route matches a request) and by typed handlers
+	// (see Typed). If nil, HandleError is used.
+	ErrorHandler func(error) (events.APIGatewayProxyResponse, error)
+
+	// Headers is a policy of headers added to every response of the router,
+	// including error responses generated when no route matches a request.
+	// See HeaderPolicy for more information.
+	Headers HeaderPolicy
+
+	// UnmatchedMiddleware are middleware functions executed for requests that
+	// do not match any route, around the 404 or 405 error response generated
+	// by the router. Global middleware is not executed for such requests, so
+	// middleware that should also apply to them (e.g. RequestIDMiddleware, so
+	// that their error responses include a request ID) must be provided here
+	// as well. Route information is not available to these functions.
+	UnmatchedMiddleware []Middleware
+
 	basePath string
 	routes   map[string]route
 	hasMiddleware
@@ -91,9 +134,28 @@ type route struct {
 
 type resource struct {
 	handler Handler
+	info    RouteInfo
 	hasMiddleware
 }
 
+// RouteInfo describes the route that matched a request. It is available to
+// middleware and handlers via RouteFromContext.
+type RouteInfo struct {
+	// Router is the router that matched the request.
+	Router *Router
+
+	// Pattern is the path pattern of the route, including the router's base
+	// path (e.g. "/api/posts/:id"). It is suitable for grouping metrics and
+	// logs by route, unlike the request path.
+	Pattern string
+
+	// Method is the HTTP method of the route.
+	Method string
+
+	// ParamNames are the names of the route's path parameters, in order.
+	ParamNames []string
+}
+
 // Middleware is a function that receives a handler function (the next function
 // in the chain, possibly another middleware or the actual handler matched for
 // a request), and returns a handler function. These functions are quite similar
@@ -209,8 +271,19 @@ func (l *Router) Route(method, path string, handler Handler, middleware ...Middl
 		}
 	}
 
+	pattern := l.basePath + strings.TrimSuffix(path, "/")
+	if pattern == "" {
+		pattern = "/"
+	}
+
 	r.methods[method] = resource{
 		handler: handler,
+		info: RouteInfo{
+			Router:     l,
+			Pattern:    pattern,
+			Method:     method,
+			ParamNames: append([]string{}, r.paramNames...),
+		},
 		hasMiddleware: hasMiddleware{
 			middleware: middleware,
 		},
@@ -251,9 +324,13 @@ func (l *Router) Handler(
 ) (events.APIGatewayProxyResponse, error) {
 	rsrc, err := l.matchRequest(&req)
 	if err != nil {
-		return HandleError(err)
+		res, err := l.handleUnmatched(ctx, req, err)
+		return l.Headers.apply(res), err
 	}
 
+	ctx = context.WithValue(ctx, routerKey{}, l)
+	ctx = context.WithValue(ctx, routeKey{}, rsrc.info)
+
 	handler := rsrc.handler
 
 	for i := len(rsrc.middleware) - 1; i >= 0; i-- {
@@ -263,7 +340,75 @@ func (l *Router) Handler(
 		handler = l.middleware[i](handler)
 	}
 
-	return handler(ctx, req)
+	res, err := handler(ctx, req)
+	return l.Headers.apply(res), err
+}
+
+// handleUnmatched generates the error response for a request that did not
+// match any route, through the router's UnmatchedMiddleware.
+func (l *Router) handleUnmatched(
+	ctx context.Context,
+	req events.APIGatewayProxyRequest,
+	matchErr error,
+) (events.APIGatewayProxyResponse, error) {
+	if len(l.UnmatchedMiddleware) == 0 {
+		return l.handleError(matchErr)
+	}
+
+	handler := Handler(func(context.Context, events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		return l.handleError(matchErr)
+	})
+	for i := len(l.UnmatchedMiddleware) - 1; i >= 0; i-- {
+		handler = l.UnmatchedMiddleware[i](handler)
+	}
+
+	return handler(context.WithValue(ctx, routerKey{}, l), req)
+}
+
+type routerKey struct{}
+
+type routeKey struct{}
+
+// RouteFromContext returns information about the route that matched the
+// request with the provided context. It is available to all middleware and
+// handlers executed by the router's Handler method, but not to requests that
+// did not match any route.
+//
+// Example:
+//
+//     func metricsMiddleware(next lmdrouter.Handler) lmdrouter.Handler {
+//         return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+//             events.APIGatewayProxyResponse,
+//             error,
+//         ) {
+//             res, err := next(ctx, req)
+//             if route, ok := lmdrouter.RouteFromContext(ctx); ok {
+//                 requests.WithLabelValues(route.Method, route.Pattern).Inc()
+//             }
+//             return res, err
+//         }
+//     }
+//
+func RouteFromContext(ctx context.Context) (RouteInfo, bool) {
+	info, ok := ctx.Value(routeKey{}).(RouteInfo)
+	return info, ok
+}
+
+// routerFromContext returns the router that is handling the request, if any.
+func routerFromContext(ctx context.Context) *Router {
+	l, _ := ctx.Value(routerKey{}).(*Router)
+	return l
+}
+
+func (l *Router) handleError(err error) (events.APIGatewayProxyResponse, error) {
+	if l == nil || l.ErrorHandler == nil {
+		return HandleError(err)
+	}
+
+	return l.ErrorHandler(err)
 }
 
 func (l *Router) matchRequest(req *events.APIGatewayProxyRequest) (
@@ -224,6 +224,43 @@ func TestRouter(t *testing.T) {
 	})
 }
 
+func TestRouteFromContext(t *testing.T) {
+	var seen []RouteInfo
+	recordRoute := func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			route, ok := RouteFromContext(ctx)
+			assert.True(t, ok, "Route must be available to middleware")
+			seen = append(seen, route)
+			return next(ctx, req)
+		}
+	}
+
+	lmd := NewRouter("/api", recordRoute)
+	lmd.Route("GET", "/", listSomethings)
+	lmd.Route("GET", "/:id/stuff/:fake", listStuff)
+
+	for _, path := range []string{"/api", "/api/fake-id/stuff/fakey-fake"} {
+		_, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       path,
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+	}
+
+	assert.Equal(t, 2, len(seen), "Middleware must be called for every request")
+	assert.Equal(t, "/api", seen[0].Pattern, "Pattern must be correct")
+	assert.Equal(t, "/api/:id/stuff/:fake", seen[1].Pattern, "Pattern must be correct")
+	assert.Equal(t, "GET", seen[1].Method, "Method must be correct")
+	assert.DeepEqual(t, []string{"id", "fake"}, seen[1].ParamNames, "Param names must be correct")
+	assert.True(t, seen[1].Router == lmd, "Router must be correct")
+
+	_, ok := RouteFromContext(context.Background())
+	assert.False(t, ok, "Route must not be available outside of the router")
+}
+
 func listSomethings(ctx context.Context, req events.APIGatewayProxyRequest) (
 	res events.APIGatewayProxyResponse,
 	err error,
@@ -0,0 +1,432 @@
+package lmdrouter
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// EncoderFunc is a function that marshals response data into a specific
+// media type. See RegisterEncoder for more information.
+type EncoderFunc func(data interface{}) ([]byte, error)
+
+type encoder struct {
+	mediaType   string
+	contentType string
+	encode      EncoderFunc
+}
+
+var jsonEncoder = encoder{
+	mediaType:   "application/json",
+	contentType: "application/json; charset=UTF-8",
+	encode:      json.Marshal,
+}
+
+var encoders = struct {
+	sync.RWMutex
+	list []encoder
+}{
+	list: []encoder{
+		jsonEncoder,
+		{"application/xml", "application/xml; charset=UTF-8", encodeXML},
+		{"text/xml", "text/xml; charset=UTF-8", encodeXML},
+		{"application/yaml", "application/yaml; charset=UTF-8", yaml.Marshal},
+		{"application/x-yaml", "application/x-yaml; charset=UTF-8", yaml.Marshal},
+		{"text/csv", "text/csv; charset=UTF-8", encodeCSV},
+		{"application/msgpack", "application/msgpack", msgpack.Marshal},
+		{"application/x-msgpack", "application/x-msgpack", msgpack.Marshal},
+		{"text/plain", "text/plain; charset=UTF-8", encodeText},
+	},
+}
+
+// RegisterEncoder registers a function that marshals response data for
+// Negotiate. contentType is the value of the "Content-Type" header of
+// responses generated by the encoder, possibly with parameters (e.g.
+// "application/json; charset=UTF-8"). If an encoder is already registered for
+// the same media type, it is replaced. Otherwise, the encoder is added with
+// the lowest priority, which is only relevant when the request's "Accept"
+// header matches multiple encoders with the same quality (e.g. "*/*").
+// Passing a nil fn removes the encoder for the media type.
+//
+// Encoders for JSON, XML, YAML, CSV, MessagePack and plain text are registered
+// by default, with JSON having the highest priority. Responses of content
+// types that are not textual (e.g. "application/msgpack") are base-64
+// encoded.
+func RegisterEncoder(contentType string, fn EncoderFunc) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+
+	encoders.Lock()
+	defer encoders.Unlock()
+
+	for i, enc := range encoders.list {
+		if enc.mediaType != mediaType {
+			continue
+		}
+
+		if fn == nil {
+			encoders.list = append(encoders.list[:i], encoders.list[i+1:]...)
+		} else {
+			encoders.list[i] = encoder{mediaType, contentType, fn}
+		}
+
+		return nil
+	}
+
+	if fn != nil {
+		encoders.list = append(encoders.list, encoder{mediaType, contentType, fn})
+	}
+
+	return nil
+}
+
+// Negotiate is the same as MarshalResponse, except that the response is
+// marshaled with the registered encoder (see RegisterEncoder) that best
+// matches the request's "Accept" header, taking quality values into account.
+// If the request does not have an "Accept" header, JSON is used. If the best
+// matching encoder fails to marshal the data (e.g. the CSV and XML encoders
+// do not support maps), the next acceptable encoder is tried. If none of the
+// registered encoders is acceptable, or none of the acceptable encoders can
+// marshal the data, a 406 Not Acceptable error response is returned. "Accept"
+// is added to the "Vary" header of the response. Slices are marshaled as XML
+// with an "items" root element.
+//
+// Example:
+//
+//     return lmdrouter.Negotiate(req, http.StatusOK, nil, output)
+//
+func Negotiate(
+	req events.APIGatewayProxyRequest,
+	status int,
+	headers map[string]string,
+	data interface{},
+) (events.APIGatewayProxyResponse, error) {
+	for _, enc := range negotiateEncoders(headerValue(req.Headers, "Accept")) {
+		b, err := enc.encode(data)
+		if err != nil {
+			continue
+		}
+
+		enc.encode = func(interface{}) ([]byte, error) {
+			return b, nil
+		}
+
+		res, err := marshalResponse(status, headers, data, enc)
+		addVary(res.Headers, "Accept")
+
+		return res, err
+	}
+
+	res, err := HandleError(HTTPError{
+		Code:    http.StatusNotAcceptable,
+		Message: "None of the accepted media types is supported",
+	})
+	res.Headers["Vary"] = "Accept"
+	return res, err
+}
+
+type acceptRange struct {
+	mediaType   string
+	q           float64
+	specificity int
+}
+
+// parseAccept parses the value of an "Accept" header into a list of media
+// ranges. Invalid ranges are ignored.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		r := acceptRange{mediaType: mediaType, q: 1, specificity: 2}
+		if qs, ok := params["q"]; ok {
+			q, err := strconv.ParseFloat(qs, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+			r.q = q
+		}
+
+		switch {
+		case mediaType == "*/*":
+			r.specificity = 0
+		case strings.HasSuffix(mediaType, "/*"):
+			r.specificity = 1
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+func (r acceptRange) matches(mediaType string) bool {
+	switch r.specificity {
+	case 0:
+		return true
+	case 1:
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*"))
+	}
+
+	return r.mediaType == mediaType
+}
+
+// negotiateEncoders returns the registered encoders that are acceptable
+// according to the value of an "Accept" header, from best to worst. The
+// quality of every encoder is taken from the most specific media range that
+// matches it, and encoders with a quality of zero are excluded. Encoders are
+// ordered by quality, with ties broken by the specificity of the matching
+// ranges, and then by the priority of the encoders. If the header is empty,
+// all encoders are returned in order of priority.
+func negotiateEncoders(accept string) []encoder {
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	if strings.TrimSpace(accept) == "" {
+		return append([]encoder{}, encoders.list...)
+	}
+
+	ranges := parseAccept(accept)
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].specificity > ranges[j].specificity
+	})
+
+	type candidate struct {
+		enc encoder
+		acceptRange
+	}
+
+	var candidates []candidate
+	for _, enc := range encoders.list {
+		for _, r := range ranges {
+			if !r.matches(enc.mediaType) {
+				continue
+			}
+
+			// only the most specific matching range applies
+			if r.q > 0 {
+				candidates = append(candidates, candidate{enc, r})
+			}
+			break
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].specificity > candidates[j].specificity
+	})
+
+	list := make([]encoder, len(candidates))
+	for i, c := range candidates {
+		list[i] = c.enc
+	}
+
+	return list
+}
+
+// isTextContentType returns true if responses of the provided content type
+// can be returned as is, without base-64 encoding.
+func isTextContentType(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := params["charset"]; ok || strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	switch {
+	case strings.HasSuffix(mediaType, "/json"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "/xml"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "yaml"),
+		mediaType == "application/javascript":
+		return true
+	}
+
+	return false
+}
+
+// encodeText marshals data as plain text. Strings and byte slices are used as
+// is, values implementing encoding.TextMarshaler or fmt.Stringer are converted
+// via these interfaces, and any other value is formatted with fmt.Sprint.
+func encodeText(data interface{}) ([]byte, error) {
+	switch d := data.(type) {
+	case string:
+		return []byte(d), nil
+	case []byte:
+		return d, nil
+	case encoding.TextMarshaler:
+		return d.MarshalText()
+	case fmt.Stringer:
+		return []byte(d.String()), nil
+	case error:
+		return []byte(d.Error()), nil
+	}
+
+	return []byte(fmt.Sprint(data)), nil
+}
+
+// encodeXML marshals data as XML. Slices and arrays (other than byte slices)
+// are wrapped in an "items" root element, so that the output is a well-formed
+// document.
+func encodeXML(data interface{}) ([]byte, error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	isList := v.Kind() == reflect.Array ||
+		(v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8)
+	if !isList {
+		return xml.Marshal(data)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<items>")
+	for i := 0; i < v.Len(); i++ {
+		b, err := xml.Marshal(v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteString("</items>")
+
+	return buf.Bytes(), nil
+}
+
+// encodeCSV marshals data as CSV. data may either be a [][]string, or a slice
+// of structs (or pointers to structs), in which case the first record is a
+// header made of the exported field names (or the names in their "csv"
+// struct tags), and every struct is converted into a record. Fields with a
+// "csv" struct tag of "-" are ignored. A single struct is converted into a
+// header and a single record.
+func encodeCSV(data interface{}) ([]byte, error) {
+	records, ok := data.([][]string)
+	if !ok {
+		var err error
+		records, err = csvRecords(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err := w.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func csvRecords(data interface{}) (records [][]string, err error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil, errors.New("cannot encode nil values as CSV")
+	}
+
+	rows := []reflect.Value{v}
+	elemType := v.Type()
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		elemType = v.Type().Elem()
+		rows = make([]reflect.Value, v.Len())
+		for i := range rows {
+			rows[i] = v.Index(i)
+		}
+	}
+
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot encode values of type %T as CSV", data)
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Tag.Get("csv")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	records = append(records, header)
+	for _, row := range rows {
+		for row.Kind() == reflect.Ptr {
+			if row.IsNil() {
+				return nil, errors.New("cannot encode nil values as CSV")
+			}
+			row = row.Elem()
+		}
+
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			record[i], err = csvValue(row.Field(field))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func csvValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	b, err := encodeText(v.Interface())
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,179 @@
+package lmdrouter
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type mockCSVItem struct {
+	ID      string    `csv:"id" xml:"id" yaml:"id" msgpack:"id"`
+	Name    string    `csv:"name" xml:"name" yaml:"name" msgpack:"name"`
+	Date    time.Time `csv:"date" xml:"-" yaml:"-" msgpack:"-"`
+	Comment *string   `csv:"comment" xml:"-" yaml:"-" msgpack:"-"`
+	Ignored string    `csv:"-" xml:"-" yaml:"-" msgpack:"-"`
+}
+
+func TestNegotiate(t *testing.T) {
+	comment := "Hi, there"
+	items := []mockCSVItem{
+		{ID: "one", Name: "First Item", Date: time.Date(2021, 11, 1, 11, 11, 11, 0, time.UTC), Comment: &comment},
+		{ID: "two", Name: "2nd Item", Date: time.Date(2021, 11, 2, 11, 11, 11, 0, time.UTC)},
+	}
+
+	negotiate := func(accept string, data interface{}) events.APIGatewayProxyResponse {
+		req := events.APIGatewayProxyRequest{}
+		if accept != "" {
+			req.Headers = map[string]string{"accept": accept}
+		}
+
+		res, err := Negotiate(req, http.StatusOK, nil, data)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "Accept", res.Headers["Vary"], "Vary header must be set")
+		return res
+	}
+
+	t.Run("no accept header", func(t *testing.T) {
+		res := negotiate("", items[0])
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+		assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "content type must be JSON")
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		res := negotiate("*/*", items[0])
+		assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "content type must be JSON")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		res := negotiate("text/csv", items)
+		assert.Equal(t, "text/csv; charset=UTF-8", res.Headers["Content-Type"], "content type must be CSV")
+		assert.False(t, res.IsBase64Encoded, "body must not be base64 encoded")
+		assert.Equal(
+			t,
+			"id,name,date,comment\n"+
+				"one,First Item,2021-11-01T11:11:11Z,\"Hi, there\"\n"+
+				"two,2nd Item,2021-11-02T11:11:11Z,\n",
+			res.Body,
+			"body must be correct",
+		)
+	})
+
+	t.Run("XML with quality values", func(t *testing.T) {
+		res := negotiate("application/json;q=0.5, application/xml;q=0.9, */*;q=0.1", items[0])
+		assert.Equal(t, "application/xml; charset=UTF-8", res.Headers["Content-Type"], "content type must be XML")
+		assert.Equal(t, "<mockCSVItem><id>one</id><name>First Item</name></mockCSVItem>", res.Body, "body must be correct")
+	})
+
+	t.Run("XML list", func(t *testing.T) {
+		res := negotiate("application/xml", items[:2])
+		assert.Equal(t, "application/xml; charset=UTF-8", res.Headers["Content-Type"], "content type must be XML")
+		assert.Equal(
+			t,
+			"<items>"+
+				"<mockCSVItem><id>one</id><name>First Item</name></mockCSVItem>"+
+				"<mockCSVItem><id>two</id><name>2nd Item</name></mockCSVItem>"+
+				"</items>",
+			res.Body,
+			"body must have a root element",
+		)
+
+		var doc struct {
+			Items []mockCSVItem `xml:"mockCSVItem"`
+		}
+		err := xml.Unmarshal([]byte(res.Body), &doc)
+		assert.Equal(t, nil, err, "body must be well-formed XML")
+		assert.Equal(t, 2, len(doc.Items), "body must include all items")
+	})
+
+	t.Run("browser defaults", func(t *testing.T) {
+		accept := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+		res := negotiate(accept, map[string]string{"id": "bla"})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+		assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "JSON must be used when XML fails")
+		assert.Equal(t, `{"id":"bla"}`, res.Body, "body must be correct")
+
+		res = negotiate(accept, items)
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+		assert.Equal(t, "application/xml; charset=UTF-8", res.Headers["Content-Type"], "content type must be XML")
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		res := negotiate("application/yaml", items[1])
+		assert.Equal(t, "application/yaml; charset=UTF-8", res.Headers["Content-Type"], "content type must be YAML")
+		assert.Equal(t, "id: two\nname: 2nd Item\n", res.Body, "body must be correct")
+	})
+
+	t.Run("MessagePack", func(t *testing.T) {
+		res := negotiate("application/msgpack", items[1])
+		assert.Equal(t, "application/msgpack", res.Headers["Content-Type"], "content type must be MessagePack")
+		assert.True(t, res.IsBase64Encoded, "body must be base64 encoded")
+
+		b, err := base64.StdEncoding.DecodeString(res.Body)
+		assert.Equal(t, nil, err, "body must be valid base64")
+		var item mockCSVItem
+		err = msgpack.Unmarshal(b, &item)
+		assert.Equal(t, nil, err, "body must be valid MessagePack")
+		assert.Equal(t, "two", item.ID, "body must be correct")
+	})
+
+	t.Run("plain text via type wildcard", func(t *testing.T) {
+		res := negotiate("text/*, text/csv;q=0, text/xml;q=0", "hello")
+		assert.Equal(t, "text/plain; charset=UTF-8", res.Headers["Content-Type"], "content type must be plain text")
+		assert.Equal(t, "hello", res.Body, "body must be correct")
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		res := negotiate("image/png, application/json;q=0", items)
+		assert.Equal(t, http.StatusNotAcceptable, res.StatusCode, "status code must be 406")
+	})
+
+	t.Run("encoding failure", func(t *testing.T) {
+		res := negotiate("text/csv", map[string]string{"id": "bla"})
+		assert.Equal(t, http.StatusNotAcceptable, res.StatusCode, "status code must be 406")
+		assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "content type must be JSON")
+	})
+
+	t.Run("encoding failure with fallback", func(t *testing.T) {
+		res := negotiate("text/csv, application/yaml;q=0.5", map[string]string{"id": "bla"})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "status code must be 200")
+		assert.Equal(t, "application/yaml; charset=UTF-8", res.Headers["Content-Type"], "next acceptable encoder must be used")
+		assert.Equal(t, "id: bla\n", res.Body, "body must be correct")
+	})
+
+	t.Run("nil data", func(t *testing.T) {
+		var item *mockCSVItem
+		for _, data := range []interface{}{nil, item} {
+			res := negotiate("text/csv", data)
+			assert.Equal(t, http.StatusNotAcceptable, res.StatusCode, "status code must be 406")
+			assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "content type must be JSON")
+		}
+	})
+
+	t.Run("custom encoder", func(t *testing.T) {
+		err := RegisterEncoder("application/vnd.fake", func(data interface{}) ([]byte, error) {
+			return []byte("fake"), nil
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		res := negotiate("application/vnd.fake", items)
+		assert.Equal(t, "application/vnd.fake", res.Headers["Content-Type"], "content type must be correct")
+		assert.True(t, res.IsBase64Encoded, "body must be base64 encoded")
+		assert.Equal(t, "ZmFrZQ==", res.Body, "body must be correct")
+
+		err = RegisterEncoder("application/vnd.fake", nil)
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		res = negotiate("application/vnd.fake", items)
+		assert.Equal(t, http.StatusNotAcceptable, res.StatusCode, "status code must be 406")
+
+		err = RegisterEncoder("not a content type", nil)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+	})
+}
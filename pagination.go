@@ -0,0 +1,356 @@
+package lmdrouter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// PageRequest holds the pagination parameters of a request to a list
+// endpoint. It can be unmarshaled from a request with UnmarshalRequest,
+// either directly or embedded in an input struct. Endpoints either use
+// offset pagination, with the "page" (starting at 1) and "page_size" query
+// parameters, or cursor pagination, with the "cursor" and "page_size" query
+// parameters. Use a Paginator to interpret the parameters.
+//
+// Example:
+//
+//     type listPostsInput struct {
+//         lmdrouter.PageRequest
+//         Author string `lambda:"query.author"`
+//     }
+//
+type PageRequest struct {
+	Page     int    `lambda:"query.page" json:"-"`
+	PageSize int    `lambda:"query.page_size" json:"-"`
+	Cursor   string `lambda:"query.cursor" json:"-"`
+}
+
+// Paginator interprets PageRequests and generates links to other pages of a
+// collection. The zero value is usable, but Secret must be set for cursors to
+// be tamper-proof.
+type Paginator struct {
+	// DefaultPageSize is the page size used if a request does not provide
+	// one. If zero, 20 is used.
+	DefaultPageSize int
+
+	// MaxPageSize is the maximum page size a request may ask for. Larger
+	// page sizes are reduced to it. If zero, 100 is used.
+	MaxPageSize int
+
+	// Secret is the key used to sign cursors with HMAC-SHA256. If empty,
+	// cursors are only encoded, meaning clients can decode and modify them.
+	Secret []byte
+}
+
+// PageLinks are the URLs of pages of a collection relative to the current
+// page. Empty URLs are omitted from responses.
+type PageLinks struct {
+	First string
+	Prev  string
+	Next  string
+	Last  string
+}
+
+// PageEnvelope is the body of responses generated by PageResponse.
+type PageEnvelope[T any] struct {
+	Items []T    `json:"items"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Size returns the page size of a request, taking the paginator's default and
+// maximum page sizes into account.
+func (p Paginator) Size(page PageRequest) int {
+	maxSize := p.MaxPageSize
+	if maxSize <= 0 {
+		maxSize = 100
+	}
+
+	size := page.PageSize
+	if size <= 0 {
+		size = p.DefaultPageSize
+		if size <= 0 {
+			size = 20
+		}
+	}
+
+	if size > maxSize {
+		size = maxSize
+	}
+
+	return size
+}
+
+// Offset returns the number of items that precede the requested page when
+// using offset pagination.
+func (p Paginator) Offset(page PageRequest) int {
+	if page.Page <= 1 {
+		return 0
+	}
+
+	return (page.Page - 1) * p.Size(page)
+}
+
+// OffsetLinks generates links to the first, previous, next and last pages of
+// a collection of total items, when using offset pagination. If total is
+// negative, the size of the collection is assumed to be unknown, in which case
+// the link to the last page is omitted, and the link to the next page is
+// always included.
+func (p Paginator) OffsetLinks(
+	req events.APIGatewayProxyRequest,
+	page PageRequest,
+	total int,
+) (links PageLinks) {
+	size := p.Size(page)
+	current := page.Page
+	if current < 1 {
+		current = 1
+	}
+
+	pageURL := func(n int) string {
+		return paginationURL(req, map[string]string{
+			"page":      strconv.Itoa(n),
+			"page_size": strconv.Itoa(size),
+			"cursor":    "",
+		})
+	}
+
+	links.First = pageURL(1)
+	if current > 1 {
+		links.Prev = pageURL(current - 1)
+	}
+
+	if total < 0 {
+		links.Next = pageURL(current + 1)
+		return links
+	}
+
+	last := (total + size - 1) / size
+	if last < 1 {
+		last = 1
+	}
+	if current < last {
+		links.Next = pageURL(current + 1)
+	}
+	links.Last = pageURL(last)
+
+	return links
+}
+
+// CursorLinks generates links to the previous and next pages of a collection
+// when using cursor pagination. next and prev are the positions of these
+// pages (e.g. the key of the last item of the current page), which are
+// encoded into cursors with EncodeCursor. A nil position omits the link.
+func (p Paginator) CursorLinks(
+	req events.APIGatewayProxyRequest,
+	page PageRequest,
+	prev, next interface{},
+) (links PageLinks, err error) {
+	size := strconv.Itoa(p.Size(page))
+
+	pageURL := func(position interface{}) (string, error) {
+		cursor, err := p.EncodeCursor(position)
+		if err != nil {
+			return "", err
+		}
+
+		return paginationURL(req, map[string]string{
+			"cursor":    cursor,
+			"page_size": size,
+			"page":      "",
+		}), nil
+	}
+
+	if prev != nil {
+		links.Prev, err = pageURL(prev)
+		if err != nil {
+			return links, err
+		}
+	}
+
+	if next != nil {
+		links.Next, err = pageURL(next)
+		if err != nil {
+			return links, err
+		}
+	}
+
+	return links, nil
+}
+
+// EncodeCursor encodes a position in a collection (any value that can be
+// marshaled to JSON) into an opaque cursor. If the paginator has a secret,
+// the cursor is signed.
+func (p Paginator) EncodeCursor(position interface{}) (string, error) {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	cursor := base64.RawURLEncoding.EncodeToString(data)
+	if len(p.Secret) == 0 {
+		return cursor, nil
+	}
+
+	return cursor + "." + base64.RawURLEncoding.EncodeToString(p.sign(cursor)), nil
+}
+
+// DecodeCursor decodes a cursor generated by EncodeCursor into target, which
+// must be a pointer. If the cursor is malformed or its signature is invalid, a
+// 400 Bad Request HTTPError is returned.
+func (p Paginator) DecodeCursor(cursor string, target interface{}) error {
+	if len(p.Secret) > 0 {
+		parts := strings.SplitN(cursor, ".", 2)
+		if len(parts) != 2 {
+			return invalidCursorError()
+		}
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil || !hmac.Equal(signature, p.sign(parts[0])) {
+			return invalidCursorError()
+		}
+
+		cursor = parts[0]
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return invalidCursorError()
+	}
+
+	if err = json.Unmarshal(data, target); err != nil {
+		return invalidCursorError()
+	}
+
+	return nil
+}
+
+func (p Paginator) sign(cursor string) []byte {
+	mac := hmac.New(sha256.New, p.Secret)
+	mac.Write([]byte(cursor)) // nolint: errcheck
+	return mac.Sum(nil)
+}
+
+func invalidCursorError() error {
+	return HTTPError{
+		Code:    http.StatusBadRequest,
+		Message: "invalid cursor",
+	}
+}
+
+// PageResponse generates a response for a page of a collection. The body is a
+// JSON PageEnvelope with the items of the page and the links to other pages,
+// and the links are also provided in an RFC 8288 "Link" header.
+//
+// Example:
+//
+//     var input listPostsInput
+//     err = lmdrouter.UnmarshalRequest(req, false, &input)
+//     if err != nil {
+//         return lmdrouter.HandleError(err)
+//     }
+//
+//     posts, total, err := listPosts(
+//         ctx,
+//         paginator.Offset(input.PageRequest),
+//         paginator.Size(input.PageRequest),
+//     )
+//     if err != nil {
+//         return lmdrouter.HandleError(err)
+//     }
+//
+//     links := paginator.OffsetLinks(req, input.PageRequest, total)
+//     return lmdrouter.PageResponse(http.StatusOK, nil, posts, links)
+//
+func PageResponse[T any](
+	status int,
+	headers map[string]string,
+	items []T,
+	links PageLinks,
+) (events.APIGatewayProxyResponse, error) {
+	if items == nil {
+		items = []T{}
+	}
+
+	var rels []string
+	for _, link := range []struct{ rel, url string }{
+		{"first", links.First},
+		{"prev", links.Prev},
+		{"next", links.Next},
+		{"last", links.Last},
+	} {
+		if link.url != "" {
+			rels = append(rels, "<"+link.url+`>; rel="`+link.rel+`"`)
+		}
+	}
+
+	if len(rels) > 0 {
+		withLinks := make(map[string]string, len(headers)+1)
+		for key, value := range headers {
+			withLinks[key] = value
+		}
+		withLinks["Link"] = strings.Join(rels, ", ")
+		headers = withLinks
+	}
+
+	return MarshalResponse(status, headers, PageEnvelope[T]{
+		Items: items,
+		First: links.First,
+		Prev:  links.Prev,
+		Next:  links.Next,
+		Last:  links.Last,
+	})
+}
+
+// paginationURL builds the URL of another page of a collection from the
+// original request, whose path already includes the router's base path. The
+// query string of the request is kept, except for the provided parameters,
+// which are replaced (or removed, if empty). If the request has a "Host"
+// header, an absolute URL is built.
+func paginationURL(
+	req events.APIGatewayProxyRequest,
+	params map[string]string,
+) string {
+	query := make(url.Values)
+	for key, values := range req.MultiValueQueryStringParameters {
+		query[key] = append([]string{}, values...)
+	}
+	for key, value := range req.QueryStringParameters {
+		if _, ok := query[key]; !ok {
+			query.Set(key, value)
+		}
+	}
+
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+
+	u := url.URL{
+		Path:     req.Path,
+		RawQuery: query.Encode(),
+	}
+
+	if host := headerValue(req.Headers, "Host"); host != "" {
+		u.Host = host
+		u.Scheme = headerValue(req.Headers, "X-Forwarded-Proto")
+		if u.Scheme == "" {
+			u.Scheme = "https"
+		}
+	}
+
+	return u.String()
+}
@@ -0,0 +1,154 @@
+package lmdrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+type mockListPostsRequest struct {
+	PageRequest
+	Author string `lambda:"query.author"`
+}
+
+type mockPostsCursor struct {
+	After string `json:"after"`
+}
+
+func TestPageRequest(t *testing.T) {
+	var input mockListPostsRequest
+	err := UnmarshalRequest(events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{
+			"page":      "3",
+			"page_size": "500",
+			"author":    "bla",
+		},
+	}, false, &input)
+	assert.Equal(t, nil, err, "Error must be nil")
+	assert.Equal(t, 3, input.Page, "Page must be bound from embedded struct")
+	assert.Equal(t, "bla", input.Author, "Author must be bound")
+
+	var paginator Paginator
+	assert.Equal(t, 100, paginator.Size(input.PageRequest), "Size must be limited")
+	assert.Equal(t, 200, paginator.Offset(input.PageRequest), "Offset must be correct")
+	assert.Equal(t, 20, paginator.Size(PageRequest{}), "Default size must be used")
+	assert.Equal(t, 0, paginator.Offset(PageRequest{}), "Offset of first page must be zero")
+}
+
+func TestPaginator(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/api/posts",
+		MultiValueQueryStringParameters: map[string][]string{
+			"page":   {"2"},
+			"author": {"bla"},
+			"tag":    {"a", "b"},
+		},
+		QueryStringParameters: map[string]string{
+			"page":   "2",
+			"author": "bla",
+		},
+	}
+
+	t.Run("offset links", func(t *testing.T) {
+		paginator := Paginator{DefaultPageSize: 10}
+		links := paginator.OffsetLinks(req, PageRequest{Page: 2}, 25)
+		assert.Equal(t, "/api/posts?author=bla&page=1&page_size=10&tag=a&tag=b", links.First, "First link must be correct")
+		assert.Equal(t, "/api/posts?author=bla&page=1&page_size=10&tag=a&tag=b", links.Prev, "Prev link must be correct")
+		assert.Equal(t, "/api/posts?author=bla&page=3&page_size=10&tag=a&tag=b", links.Next, "Next link must be correct")
+		assert.Equal(t, "/api/posts?author=bla&page=3&page_size=10&tag=a&tag=b", links.Last, "Last link must be correct")
+
+		links = paginator.OffsetLinks(req, PageRequest{Page: 3}, 25)
+		assert.Equal(t, "", links.Next, "Next link must be omitted on last page")
+
+		links = paginator.OffsetLinks(req, PageRequest{}, -1)
+		assert.Equal(t, "", links.Prev, "Prev link must be omitted on first page")
+		assert.Equal(t, "", links.Last, "Last link must be omitted for unknown totals")
+		assert.Equal(t, "/api/posts?author=bla&page=2&page_size=10&tag=a&tag=b", links.Next, "Next link must be correct")
+	})
+
+	t.Run("absolute links", func(t *testing.T) {
+		withHost := req
+		withHost.Headers = map[string]string{"host": "api.example.com"}
+		links := Paginator{}.OffsetLinks(withHost, PageRequest{}, 0)
+		assert.Equal(t, "https://api.example.com/api/posts?author=bla&page=1&page_size=20&tag=a&tag=b", links.First, "Link must be absolute")
+	})
+
+	t.Run("signed cursors", func(t *testing.T) {
+		paginator := Paginator{Secret: []byte("s3cr3t")}
+		links, err := paginator.CursorLinks(req, PageRequest{Cursor: "bla"}, nil, mockPostsCursor{After: "post-10"})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "", links.Prev, "Prev link must be omitted")
+
+		cursor, err := paginator.EncodeCursor(mockPostsCursor{After: "post-10"})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "/api/posts?author=bla&cursor="+cursor+"&page_size=20&tag=a&tag=b", links.Next, "Next link must be correct")
+
+		var decoded mockPostsCursor
+		err = paginator.DecodeCursor(cursor, &decoded)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "post-10", decoded.After, "Cursor must be decoded")
+
+		forged, _ := Paginator{}.EncodeCursor(mockPostsCursor{After: "post-99"})
+		for _, invalid := range []string{forged, forged + "." + cursor[len(cursor)-43:], "!!!", ""} {
+			err = paginator.DecodeCursor(invalid, &decoded)
+			var httpErr HTTPError
+			ok := errors.As(err, &httpErr)
+			assert.True(t, ok, "Error must be an HTTPError")
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code, "Error code must be 400")
+		}
+	})
+}
+
+func TestPageResponse(t *testing.T) {
+	lmd := NewRouter("/api")
+	lmd.Route("GET", "/posts", func(_ context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		var input mockListPostsRequest
+		err := UnmarshalRequest(req, false, &input)
+		if err != nil {
+			return HandleError(err)
+		}
+
+		paginator := Paginator{DefaultPageSize: 2}
+		links := paginator.OffsetLinks(req, input.PageRequest, 3)
+		posts := []string{"one", "two", "three"}[paginator.Offset(input.PageRequest):]
+		if len(posts) > paginator.Size(input.PageRequest) {
+			posts = posts[:paginator.Size(input.PageRequest)]
+		}
+
+		return PageResponse(http.StatusOK, nil, posts, links)
+	})
+
+	res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:            "GET",
+		Path:                  "/api/posts",
+		QueryStringParameters: map[string]string{"page": "1"},
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+	assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+	assert.Equal(
+		t,
+		`</api/posts?page=1&page_size=2>; rel="first", </api/posts?page=2&page_size=2>; rel="next", </api/posts?page=2&page_size=2>; rel="last"`,
+		res.Headers["Link"],
+		"Link header must be correct",
+	)
+
+	var envelope PageEnvelope[string]
+	err = json.Unmarshal([]byte(res.Body), &envelope)
+	assert.Equal(t, nil, err, "Body must be valid JSON")
+	assert.DeepEqual(t, []string{"one", "two"}, envelope.Items, "Items must be correct")
+	assert.Equal(t, "/api/posts?page=2&page_size=2", envelope.Next, "Next link must be correct")
+	assert.Equal(t, "", envelope.Prev, "Prev link must be omitted")
+
+	res, _ = PageResponse[string](http.StatusOK, nil, nil, PageLinks{})
+	assert.Equal(t, `{"items":[]}`, res.Body, "Empty pages must have an empty list of items")
+	assert.Equal(t, "", res.Headers["Link"], "Link header must be omitted")
+}
@@ -0,0 +1,611 @@
+package lmdrouter
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// structPlan describes how the lambda-tagged fields of a struct type are
+// filled from a request. Plans are compiled once per struct type and cached,
+// so that struct tags are only parsed and field types are only inspected the
+// first time a type is used.
+type structPlan struct {
+	fields      []fieldPlan
+	queryParams map[string]reflect.Kind
+}
+
+type fieldPlan struct {
+	index []int
+	tag   lambdaTag
+	kind  reflect.Kind
+	bind  fieldBinder
+}
+
+// fieldBinder fills a field with the value(s) of a parameter, taken from
+// params and multiParam.
+type fieldBinder func(
+	valueField reflect.Value,
+	params map[string]string,
+	multiParam map[string][]string,
+	param string,
+	opts DecoderOptions,
+) error
+
+// valueDecoder parses a single string value into valueField.
+type valueDecoder func(
+	valueField reflect.Value,
+	param string,
+	str string,
+	opts DecoderOptions,
+) error
+
+var plans sync.Map
+
+// Precompile compiles and caches the plan used by UnmarshalRequest to fill
+// structs of the same type as target, which must be a struct or a pointer to
+// a struct. Plans are otherwise compiled the first time a type is passed to
+// UnmarshalRequest. Calling Precompile during initialization allows invalid
+// lambda struct tags and unsupported field types to be detected early, and
+// avoids paying the compilation cost on the first request:
+//
+//     func init() {
+//         if err := lmdrouter.Precompile(listPostsInput{}); err != nil {
+//             panic(err)
+//         }
+//     }
+//
+func Precompile(target interface{}) error {
+	t := reflect.TypeOf(target)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil {
+		return errors.New("invalid precompile target, must be struct")
+	}
+
+	_, err := planFor(t)
+	return err
+}
+
+// planFor returns the cached plan for the struct type t, compiling it if
+// necessary.
+func planFor(t reflect.Type) (*structPlan, error) {
+	if plan, ok := plans.Load(t); ok {
+		return plan.(*structPlan), nil
+	}
+
+	plan, err := compilePlan(t)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := plans.LoadOrStore(t, plan)
+	return actual.(*structPlan), nil
+}
+
+// resetPlans removes all cached plans. It is called when decoders are
+// registered, since plans depend on the registered decoders.
+func resetPlans() {
+	plans.Range(func(key, _ interface{}) bool {
+		plans.Delete(key)
+		return true
+	})
+}
+
+func compilePlan(t reflect.Type) (*structPlan, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("invalid unmarshal target, must be pointer to struct")
+	}
+
+	plan := &structPlan{
+		queryParams: make(map[string]reflect.Kind),
+	}
+
+	err := plan.compileFields(t, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// compileFields adds the lambda-tagged fields of the struct type t to the
+// plan. Fields of embedded structs without a lambda tag are added as well,
+// so that common parameters (e.g. PageRequest) can be shared between input
+// types.
+func (plan *structPlan) compileFields(t reflect.Type, parentIndex []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		typeField := t.Field(i)
+		index := append(append([]int{}, parentIndex...), i)
+
+		lambdaTag := typeField.Tag.Get("lambda")
+		if lambdaTag == "" {
+			if typeField.Anonymous && typeField.Type.Kind() == reflect.Struct {
+				err := plan.compileFields(typeField.Type, index)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		tag, err := parseLambdaTag(typeField.Name, lambdaTag)
+		if err != nil {
+			return err
+		}
+
+		switch tag.location {
+		case "query", "path", "header":
+		default:
+			return fmt.Errorf(
+				"invalid param location %q for field %s",
+				tag.location, typeField.Name,
+			)
+		}
+
+		if typeField.PkgPath != "" {
+			return fmt.Errorf(
+				"lambda tag used on unexported field %s",
+				typeField.Name,
+			)
+		}
+
+		kind, bind, err := compileBinder(
+			typeField.Type,
+			typeField.Tag.Get("layout"),
+		)
+		if err != nil {
+			return fmt.Errorf("invalid field %s: %w", typeField.Name, err)
+		}
+
+		if kind == reflect.Map && tag.hasDefault {
+			return fmt.Errorf(
+				"default values are not supported for map field %s",
+				typeField.Name,
+			)
+		}
+
+		if tag.location == "query" {
+			plan.queryParams[tag.name] = kind
+		}
+
+		plan.fields = append(plan.fields, fieldPlan{
+			index: index,
+			tag:   tag,
+			kind:  kind,
+			bind:  bind,
+		})
+	}
+
+	return nil
+}
+
+type lambdaTag struct {
+	location     string
+	name         string
+	required     bool
+	hasDefault   bool
+	defaultValue string
+}
+
+// parseLambdaTag parses the value of a "lambda" struct tag, which is made of
+// a location and a parameter name separated by a dot (e.g. "query.page"),
+// optionally followed by comma-separated options. Since default values of
+// slice fields are themselves comma-separated, the "default" option must come
+// last, and its value extends to the end of the tag.
+func parseLambdaTag(fieldName, value string) (tag lambdaTag, err error) {
+	parts := strings.SplitN(value, ",", 2)
+
+	components := strings.Split(parts[0], ".")
+	if len(components) != 2 {
+		return tag, fmt.Errorf("invalid lambda tag for field %s", fieldName)
+	}
+
+	tag.location = components[0]
+	tag.name = components[1]
+
+	if len(parts) == 1 {
+		return tag, nil
+	}
+
+	opts := parts[1]
+	for opts != "" {
+		var opt string
+		if strings.HasPrefix(opts, "default=") {
+			opt, opts = opts, ""
+		} else {
+			parts = strings.SplitN(opts, ",", 2)
+			opt, opts = parts[0], ""
+			if len(parts) == 2 {
+				opts = parts[1]
+			}
+		}
+
+		switch {
+		case opt == "required":
+			tag.required = true
+		case strings.HasPrefix(opt, "default="):
+			tag.hasDefault = true
+			tag.defaultValue = strings.TrimPrefix(opt, "default=")
+		default:
+			return tag, fmt.Errorf(
+				"invalid lambda tag option %q for field %s",
+				opt, fieldName,
+			)
+		}
+	}
+
+	return tag, nil
+}
+
+// bindingKind returns reflect.Slice if a field of type typ is filled from a
+// list of values (i.e. it is a slice or an array), reflect.Map if it is filled
+// from bracketed query string parameters (e.g. "filter[status]"), or
+// reflect.Invalid if it is filled from a single value.
+func bindingKind(typ reflect.Type, layout string) reflect.Kind {
+	if customDecoder(typ, layout) != nil {
+		return reflect.Invalid
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		return reflect.Slice
+	case reflect.Map:
+		return reflect.Map
+	}
+
+	return reflect.Invalid
+}
+
+// compileBinder returns the binding kind of fields of type typ, and a
+// function that fills such fields.
+func compileBinder(typ reflect.Type, layout string) (
+	kind reflect.Kind,
+	bind fieldBinder,
+	err error,
+) {
+	kind = bindingKind(typ, layout)
+
+	switch kind {
+	case reflect.Slice:
+		decode, err := compileDecoder(typ.Elem(), layout)
+		if err != nil {
+			return kind, nil, err
+		}
+		return kind, listBinder(typ, decode), nil
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return kind, nil, fmt.Errorf("unsupported map key type %s", typ.Key())
+		}
+		if bindingKind(typ.Elem(), layout) == reflect.Map {
+			return kind, nil, fmt.Errorf("unsupported nested map type %s", typ)
+		}
+		_, elemBind, err := compileBinder(typ.Elem(), layout)
+		if err != nil {
+			return kind, nil, err
+		}
+		return kind, mapBinder(typ, elemBind), nil
+	}
+
+	decode, err := compileDecoder(typ, layout)
+	if err != nil {
+		return kind, nil, err
+	}
+
+	return kind, func(
+		valueField reflect.Value,
+		params map[string]string,
+		_ map[string][]string,
+		param string,
+		opts DecoderOptions,
+	) error {
+		str, ok := params[param]
+		if !ok {
+			return nil
+		}
+
+		return decode(valueField, param, str, opts)
+	}, nil
+}
+
+// listBinder returns a binder for slice and array fields. Values are taken
+// from multiParam if the parameter exists there, otherwise from params, in
+// which case the value is assumed to be a comma-separated list. If the
+// parameter does not exist, values are taken from the bracketed form of the
+// parameter (e.g. "ids[]=1&ids[]=2"), in which case each value is taken as
+// is.
+func listBinder(typ reflect.Type, decode valueDecoder) fieldBinder {
+	return func(
+		valueField reflect.Value,
+		params map[string]string,
+		multiParam map[string][]string,
+		param string,
+		opts DecoderOptions,
+	) error {
+		strs, ok := multiParam[param]
+		if !ok {
+			var str string
+			str, ok = params[param]
+			if ok {
+				strs = strings.Split(str, ",")
+			}
+		}
+		if !ok {
+			strs, ok = multiParam[param+"[]"]
+		}
+		if !ok {
+			var str string
+			str, ok = params[param+"[]"]
+			if !ok {
+				return nil
+			}
+			strs = []string{str}
+		}
+
+		list := valueField
+		if typ.Kind() == reflect.Slice {
+			list = reflect.MakeSlice(typ, len(strs), len(strs))
+		} else if len(strs) > typ.Len() {
+			return HTTPError{
+				Code: http.StatusBadRequest,
+				Message: fmt.Sprintf(
+					"%s must not have more than %d values",
+					param, typ.Len(),
+				),
+			}
+		}
+
+		for i, str := range strs {
+			err := decode(list.Index(i), param, str, opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		if typ.Kind() == reflect.Slice {
+			valueField.Set(list)
+		}
+
+		return nil
+	}
+}
+
+// mapBinder returns a binder for map fields, which are filled from bracketed
+// parameters, as used by the OpenAPI "deepObject" style (e.g.
+// "filter[status]=open&filter[owner]=me"). Values of the map are filled by
+// elemBind, so they may be of any type supported for regular fields,
+// including slices.
+func mapBinder(typ reflect.Type, elemBind fieldBinder) fieldBinder {
+	return func(
+		valueField reflect.Value,
+		params map[string]string,
+		multiParam map[string][]string,
+		param string,
+		opts DecoderOptions,
+	) error {
+		keys := make(map[string]string)
+		for key := range params {
+			if inner, ok := mapParamKey(param, key); ok {
+				keys[key] = inner
+			}
+		}
+		for key := range multiParam {
+			if inner, ok := mapParamKey(param, key); ok {
+				keys[key] = inner
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		m := reflect.MakeMapWithSize(typ, len(keys))
+		for key, inner := range keys {
+			value := reflect.New(typ.Elem()).Elem()
+			err := elemBind(value, params, multiParam, key, opts)
+			if err != nil {
+				return err
+			}
+
+			m.SetMapIndex(reflect.ValueOf(inner).Convert(typ.Key()), value)
+		}
+
+		valueField.Set(m)
+
+		return nil
+	}
+}
+
+// compileDecoder returns a function that parses a single string value into a
+// value of type typ. Pointers are allocated as necessary.
+func compileDecoder(typ reflect.Type, layout string) (valueDecoder, error) {
+	if decode := customDecoder(typ, layout); decode != nil {
+		return func(
+			valueField reflect.Value,
+			param string,
+			str string,
+			_ DecoderOptions,
+		) error {
+			value, err := decode(param, str)
+			if err != nil {
+				return err
+			}
+			valueField.Set(value)
+			return nil
+		}, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		elemType := typ.Elem()
+		decodeElem, err := compileDecoder(elemType, layout)
+		if err != nil {
+			return nil, err
+		}
+		return func(
+			valueField reflect.Value,
+			param string,
+			str string,
+			opts DecoderOptions,
+		) error {
+			ptr := reflect.New(elemType)
+			err := decodeElem(ptr.Elem(), param, str, opts)
+			if err != nil {
+				return err
+			}
+			valueField.Set(ptr)
+			return nil
+		}, nil
+	case reflect.String:
+		return func(valueField reflect.Value, _, str string, _ DecoderOptions) error {
+			valueField.SetString(str)
+			return nil
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bitSize := typ.Bits()
+		return func(valueField reflect.Value, param, str string, _ DecoderOptions) error {
+			value, err := parseIntParam(param, str, bitSize)
+			if err != nil {
+				return err
+			}
+			valueField.SetInt(value)
+			return nil
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bitSize := typ.Bits()
+		return func(valueField reflect.Value, param, str string, _ DecoderOptions) error {
+			value, err := parseUintParam(param, str, bitSize)
+			if err != nil {
+				return err
+			}
+			valueField.SetUint(value)
+			return nil
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		bitSize := typ.Bits()
+		return func(valueField reflect.Value, param, str string, _ DecoderOptions) error {
+			value, err := parseFloatParam(param, str, bitSize)
+			if err != nil {
+				return err
+			}
+			valueField.SetFloat(value)
+			return nil
+		}, nil
+	case reflect.Bool:
+		return func(valueField reflect.Value, param, str string, opts DecoderOptions) error {
+			value, err := opts.parseBool(param, str)
+			if err != nil {
+				return err
+			}
+			valueField.SetBool(value)
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// customDecoder returns a function that decodes a string value into a value of
+// type typ, if typ has a registered decoder, is a time.Time with a custom
+// layout, or implements encoding.TextUnmarshaler. Otherwise, nil is returned
+// and the value should be decoded based on the type's kind.
+func customDecoder(typ reflect.Type, layout string) func(param, str string) (
+	reflect.Value,
+	error,
+) {
+	decoders.RLock()
+	fn, ok := decoders.funcs[typ]
+	decoders.RUnlock()
+
+	switch {
+	case ok:
+		return func(param, str string) (value reflect.Value, err error) {
+			out, err := fn(str)
+			if err != nil {
+				return value, invalidParamError(param, err)
+			}
+
+			value = reflect.ValueOf(out)
+			if !value.IsValid() || value.Kind() != typ.Kind() || !value.Type().ConvertibleTo(typ) {
+				return value, fmt.Errorf(
+					"decoder for type %s returned a value of type %T",
+					typ, out,
+				)
+			}
+
+			return value.Convert(typ), nil
+		}
+	case typ == timeType && layout != "":
+		return func(param, str string) (value reflect.Value, err error) {
+			t, err := time.Parse(layout, str)
+			if err != nil {
+				return value, invalidParamError(param, err)
+			}
+
+			return reflect.ValueOf(t), nil
+		}
+	case reflect.PtrTo(typ).Implements(textUnmarshalerType):
+		return func(param, str string) (value reflect.Value, err error) {
+			ptr := reflect.New(typ)
+			err = ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+			if err != nil {
+				return value, invalidParamError(param, err)
+			}
+
+			return ptr.Elem(), nil
+		}
+	}
+
+	return nil
+}
+
+func invalidParamError(param string, err error) error {
+	return HTTPError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("invalid value for %s: %s", param, err),
+	}
+}
+
+func parseIntParam(param, str string, bitSize int) (value int64, err error) {
+	value, err = strconv.ParseInt(str, 10, bitSize)
+	if err != nil {
+		return value, HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("%s must be a valid integer", param),
+		}
+	}
+
+	return value, nil
+}
+
+func parseUintParam(param, str string, bitSize int) (value uint64, err error) {
+	value, err = strconv.ParseUint(str, 10, bitSize)
+	if err != nil {
+		return value, HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("%s must be a valid, positive integer", param),
+		}
+	}
+
+	return value, nil
+}
+
+func parseFloatParam(param, str string, bitSize int) (value float64, err error) {
+	value, err = strconv.ParseFloat(str, bitSize)
+	if err != nil {
+		return value, HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("%s must be a valid floating point number", param),
+		}
+	}
+
+	return value, nil
+}
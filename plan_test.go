@@ -0,0 +1,132 @@
+package lmdrouter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestPrecompile(t *testing.T) {
+	t.Run("valid struct", func(t *testing.T) {
+		resetPlans()
+		err := Precompile(mockListRequest{})
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		_, ok := plans.Load(reflect.TypeOf(mockListRequest{}))
+		assert.True(t, ok, "Plan must be cached")
+	})
+
+	t.Run("pointer to valid struct", func(t *testing.T) {
+		err := Precompile(&mockFilterRequest{})
+		assert.Equal(t, nil, err, "Error must be nil")
+	})
+
+	t.Run("not a struct", func(t *testing.T) {
+		err := Precompile("bla")
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+
+		err = Precompile(nil)
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+	})
+
+	t.Run("invalid tags", func(t *testing.T) {
+		for name, target := range map[string]interface{}{
+			"missing location": struct {
+				ID string `lambda:"id"`
+			}{},
+			"invalid location": struct {
+				ID string `lambda:"body.id"`
+			}{},
+			"invalid option": struct {
+				ID string `lambda:"path.id,optional"`
+			}{},
+			"unsupported type": struct {
+				ID chan string `lambda:"path.id"`
+			}{},
+			"unsupported map key": struct {
+				Filter map[int]string `lambda:"query.filter"`
+			}{},
+			"nested map": struct {
+				Filter map[string]map[string]string `lambda:"query.filter"`
+			}{},
+			"map default": struct {
+				Filter map[string]string `lambda:"query.filter,default=a"`
+			}{},
+			"unexported field": struct {
+				id string `lambda:"path.id"` // nolint: unused
+			}{},
+		} {
+			err := Precompile(target)
+			assert.NotEqual(t, nil, err, "Error must not be nil for "+name)
+		}
+	})
+
+	t.Run("registering decoders resets plans", func(t *testing.T) {
+		RegisterDecoder(reflect.TypeOf(mockPoint{}), func(str string) (interface{}, error) {
+			return mockPoint{}, nil
+		})
+		err := Precompile(mockCustomRequest{})
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		RegisterDecoder(reflect.TypeOf(mockPoint{}), nil)
+		_, ok := plans.Load(reflect.TypeOf(mockCustomRequest{}))
+		assert.False(t, ok, "Plan must be removed from cache")
+
+		err = Precompile(mockCustomRequest{})
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+	})
+}
+
+var benchmarkRequest = events.APIGatewayProxyRequest{
+	PathParameters: map[string]string{
+		"id": "fake-scan-id",
+	},
+	QueryStringParameters: map[string]string{
+		"page":       "2",
+		"page_size":  "30",
+		"const":      "two",
+		"bool":       "true",
+		"pbool1":     "0",
+		"time":       "2021-11-01T11:11:11.000Z",
+		"alias":      "hello",
+		"alias_ptr":  "world",
+		"commaSplit": "one,two,three",
+	},
+	MultiValueQueryStringParameters: map[string][]string{
+		"terms":   []string{"one", "two"},
+		"numbers": []string{"1.2", "3.5", "666.666"},
+	},
+	Headers: map[string]string{
+		"Accept-Language": "en-us",
+	},
+	MultiValueHeaders: map[string][]string{
+		"Accept-Encoding": []string{"gzip", "deflate"},
+	},
+}
+
+func BenchmarkUnmarshalRequest(b *testing.B) {
+	b.Run("cached plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var input mockListRequest
+			err := UnmarshalRequest(benchmarkRequest, false, &input)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cold plan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			resetPlans()
+			var input mockListRequest
+			err := UnmarshalRequest(benchmarkRequest, false, &input)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package lmdrouter
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HeaderPolicy is a declarative set of headers that are added to responses,
+// either to all responses of a router (see the Headers field of Router), or
+// to the responses of specific routes or groups of routes (see
+// HeadersMiddleware). Headers of a policy never override headers that are
+// already present in a response, so handlers can still set them explicitly,
+// and policies of routes and groups take precedence over those of the router.
+// Empty fields are ignored.
+type HeaderPolicy struct {
+	// CacheControl is the value of the "Cache-Control" header, e.g.
+	// "public, max-age=300" or "no-store".
+	CacheControl string
+
+	// StrictTransportSecurity is the value of the "Strict-Transport-Security"
+	// header, e.g. "max-age=63072000; includeSubDomains".
+	StrictTransportSecurity string
+
+	// ContentTypeOptions is the value of the "X-Content-Type-Options" header,
+	// which should be "nosniff".
+	ContentTypeOptions string
+
+	// ContentSecurityPolicy is the value of the "Content-Security-Policy"
+	// header, e.g. "default-src 'none'".
+	ContentSecurityPolicy string
+
+	// Headers are additional static headers.
+	Headers map[string]string
+}
+
+// SecurityHeaders is a header policy with security headers suitable for
+// JSON APIs that are only served over HTTPS.
+var SecurityHeaders = HeaderPolicy{
+	StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+	ContentTypeOptions:      "nosniff",
+	ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'",
+}
+
+// HeadersMiddleware returns a middleware that adds the headers of a policy to
+// every response of the routes it is applied to, including error responses
+// generated by handlers and by middleware that follows it in the chain.
+// Policies should therefore be passed before other middleware when creating
+// routes and groups.
+//
+// Example:
+//
+//     router.Route("GET", "/articles", listArticles, lmdrouter.HeadersMiddleware(
+//         lmdrouter.HeaderPolicy{CacheControl: "public, max-age=300"},
+//     ))
+//
+func HeadersMiddleware(policy HeaderPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			res, err = next(ctx, req)
+			return policy.apply(res), err
+		}
+	}
+}
+
+// apply adds the headers of the policy that are not already present to a
+// response. The response's headers map is copied rather than modified, since
+// handlers may reuse the same map across responses.
+func (p HeaderPolicy) apply(
+	res events.APIGatewayProxyResponse,
+) events.APIGatewayProxyResponse {
+	policyHeaders := map[string]string{
+		"Cache-Control":             p.CacheControl,
+		"Strict-Transport-Security": p.StrictTransportSecurity,
+		"X-Content-Type-Options":    p.ContentTypeOptions,
+		"Content-Security-Policy":   p.ContentSecurityPolicy,
+	}
+	for key, value := range p.Headers {
+		policyHeaders[key] = value
+	}
+
+	var headers map[string]string
+	for key, value := range policyHeaders {
+		if value == "" || hasHeader(res.Headers, key) ||
+			hasMultiValueHeader(res.MultiValueHeaders, key) {
+			continue
+		}
+
+		if headers == nil {
+			headers = make(map[string]string, len(res.Headers)+len(policyHeaders))
+			for k, v := range res.Headers {
+				headers[k] = v
+			}
+		}
+
+		headers[key] = value
+	}
+
+	if headers != nil {
+		res.Headers = headers
+	}
+
+	return res
+}
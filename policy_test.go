@@ -0,0 +1,146 @@
+package lmdrouter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestHeaderPolicies(t *testing.T) {
+	sharedHeaders := map[string]string{"X-Shared": "true"}
+
+	lmd := NewRouter("/api")
+	lmd.Headers = HeaderPolicy{
+		CacheControl:       "no-store",
+		ContentTypeOptions: "nosniff",
+		Headers:            map[string]string{"X-Service": "things"},
+	}
+	lmd.Route("GET", "/", func(_ context.Context, _ events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		return MarshalResponse(http.StatusOK, sharedHeaders, []string{})
+	})
+	lmd.Route("GET", "/explicit", func(_ context.Context, _ events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		return MarshalResponse(http.StatusOK, map[string]string{
+			"cache-control": "private",
+		}, []string{})
+	})
+
+	public := lmd.Group("/public", HeadersMiddleware(HeaderPolicy{
+		CacheControl: "public, max-age=300",
+	}))
+	public.Route("GET", "/:id", func(_ context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		if req.PathParameters["id"] == "missing" {
+			return HandleError(HTTPError{http.StatusNotFound, "No such item"})
+		}
+		return MarshalResponse(http.StatusOK, nil, req.PathParameters)
+	}, HeadersMiddleware(SecurityHeaders))
+
+	get := func(path string) events.APIGatewayProxyResponse {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       path,
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		return res
+	}
+
+	t.Run("router policy", func(t *testing.T) {
+		res := get("/api")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "no-store", res.Headers["Cache-Control"], "Cache-Control must be set")
+		assert.Equal(t, "nosniff", res.Headers["X-Content-Type-Options"], "X-Content-Type-Options must be set")
+		assert.Equal(t, "things", res.Headers["X-Service"], "Static headers must be set")
+		assert.Equal(t, "true", res.Headers["X-Shared"], "Handler headers must be kept")
+		assert.Equal(t, 1, len(sharedHeaders), "Handler headers must not be modified")
+	})
+
+	t.Run("explicit handler headers", func(t *testing.T) {
+		res := get("/api/explicit")
+		assert.Equal(t, "private", res.Headers["cache-control"], "Handler headers must not be overridden")
+		assert.Equal(t, "", res.Headers["Cache-Control"], "Policy header must not be added")
+	})
+
+	t.Run("group and route policies", func(t *testing.T) {
+		res := get("/api/public/bla")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "public, max-age=300", res.Headers["Cache-Control"], "Group policy must take precedence")
+		assert.Equal(
+			t,
+			SecurityHeaders.StrictTransportSecurity,
+			res.Headers["Strict-Transport-Security"],
+			"Route policy must be applied",
+		)
+		assert.Equal(t, "things", res.Headers["X-Service"], "Router policy must be applied")
+	})
+
+	t.Run("error responses", func(t *testing.T) {
+		res := get("/api/public/missing")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+		assert.Equal(t, "public, max-age=300", res.Headers["Cache-Control"], "Group policy must be applied")
+
+		res = get("/api/nothing/here")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+		assert.Equal(t, "no-store", res.Headers["Cache-Control"], "Router policy must be applied")
+		assert.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"], "Content-Type must be kept")
+
+		res, _ = lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "DELETE",
+			Path:       "/api",
+		})
+		assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode, "Status code must be 405")
+		assert.Equal(t, "things", res.Headers["X-Service"], "Router policy must be applied")
+	})
+}
+
+func TestGroups(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+				events.APIGatewayProxyResponse,
+				error,
+			) {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+
+	lmd := NewRouter("/api", mark("global"))
+	v1 := lmd.Group("/v1", mark("v1"))
+	users := v1.Group("/users", mark("users"))
+	users.Route("GET", "/:id", func(_ context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		calls = append(calls, "handler")
+		return MarshalResponse(http.StatusOK, nil, req.PathParameters)
+	}, mark("route"))
+
+	_, ok := lmd.routes["/v1/users/:id"]
+	assert.True(t, ok, "Route must be registered with the full path")
+
+	res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/api/v1/users/bla",
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+	assert.Equal(t, `{"id":"bla"}`, res.Body, "Body must be correct")
+	assert.DeepEqual(
+		t,
+		[]string{"global", "v1", "users", "route", "handler"},
+		calls,
+		"Middleware must be executed in order",
+	)
+}
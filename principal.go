@@ -0,0 +1,238 @@
+package lmdrouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Principal is the authenticated caller of a request, regardless of how it
+// was authenticated. It is filled by the authentication middleware of the
+// library (JWTMiddleware, BasicAuthMiddleware and APIKeyMiddleware), by
+// custom middleware via WithPrincipal, or from the context of an API Gateway
+// authorizer. See RequestPrincipal for more information.
+type Principal struct {
+	// ID identifies the caller, e.g. the subject of a token, a username or
+	// the owner of an API key.
+	ID string
+
+	// Scopes are the scopes granted to the caller.
+	Scopes []string
+
+	// Roles are the roles (or groups) the caller belongs to.
+	Roles []string
+
+	// Claims are additional attributes of the caller, such as the claims of
+	// a token or the context of an API Gateway authorizer. May be nil.
+	Claims map[string]interface{}
+}
+
+// HasScope returns true if the principal was granted a scope.
+func (p Principal) HasScope(scope string) bool {
+	return containsString(p.Scopes, scope)
+}
+
+// HasRole returns true if the principal belongs to a role.
+func (p Principal) HasRole(role string) bool {
+	return containsString(p.Roles, role)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of a context with the principal of a request.
+// Custom authentication middleware should use it to store the principals
+// they authenticate, so that RequireScopes and RequireRole can be used with
+// them.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// RequestPrincipal returns the principal of a request. If an authentication
+// middleware stored a principal in the request's context (see WithPrincipal),
+// it is returned. Otherwise, the principal is taken from the context of the
+// API Gateway authorizer that authorized the request, if any: the ID is taken
+// from the "principalId" key (Lambda authorizers) or the "sub" claim (Cognito
+// user pool authorizers), the scopes from the "scope", "scopes" or "scp" key,
+// and the roles from the "roles", "role" or "cognito:groups" key. Values may
+// be lists, or strings separated by spaces or commas. Authorizer contexts
+// without an ID or claims (e.g. holding only "integrationLatency") are not
+// principals.
+func RequestPrincipal(ctx context.Context, req events.APIGatewayProxyRequest) (
+	Principal,
+	bool,
+) {
+	if p, ok := ctx.Value(principalKey{}).(Principal); ok {
+		return p, true
+	}
+
+	authorizer := req.RequestContext.Authorizer
+	if len(authorizer) == 0 {
+		return Principal{}, false
+	}
+
+	claims, hasClaims := authorizer["claims"].(map[string]interface{})
+	if !hasClaims {
+		claims = authorizer
+	}
+
+	p := principalFromClaims(claims)
+	if id, ok := authorizer["principalId"].(string); ok && id != "" {
+		p.ID = id
+	}
+
+	// API Gateway adds keys such as "integrationLatency" to the authorizer
+	// context even without an authorizer, so these do not make a principal.
+	if p.ID == "" && (!hasClaims || len(claims) == 0) {
+		return Principal{}, false
+	}
+
+	return p, true
+}
+
+// principalFromClaims builds a principal from the claims of a token or the
+// context of an API Gateway authorizer.
+func principalFromClaims(claims map[string]interface{}) Principal {
+	p := Principal{Claims: claims}
+	p.ID, _ = claims["sub"].(string)
+
+	for _, key := range []string{"scope", "scopes", "scp"} {
+		if value, ok := claims[key]; ok {
+			p.Scopes = claimList(value)
+			break
+		}
+	}
+
+	for _, key := range []string{"roles", "role", "cognito:groups"} {
+		if value, ok := claims[key]; ok {
+			p.Roles = claimList(value)
+			break
+		}
+	}
+
+	return p
+}
+
+// claimList converts the value of a claim into a list of strings. Lists are
+// converted as is, while strings are split by spaces and commas (surrounding
+// brackets, as used by API Gateway for lists in authorizer contexts, are
+// removed).
+func claimList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+		return strings.FieldsFunc(v, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequireScopes returns a middleware that only allows requests whose
+// principal (see RequestPrincipal) was granted all of the provided scopes.
+// Requests without a principal are rejected with a 401 Unauthorized error
+// response, and requests whose principal lacks any of the scopes are rejected
+// with a 403 Forbidden error response, both generated by the router's error
+// handler. The middleware must follow the authentication middleware in the
+// chain.
+//
+// Example:
+//
+//     router.Route("POST", "/articles", createArticle, lmdrouter.RequireScopes("articles:write"))
+//
+func RequireScopes(scopes ...string) Middleware {
+	return requirePrincipal(func(p Principal) error {
+		var missing []string
+		for _, scope := range scopes {
+			if !p.HasScope(scope) {
+				missing = append(missing, scope)
+			}
+		}
+
+		if len(missing) == 0 {
+			return nil
+		}
+
+		return HTTPError{
+			Code: http.StatusForbidden,
+			Message: fmt.Sprintf(
+				"missing required scope(s): %s",
+				strings.Join(missing, ", "),
+			),
+		}
+	})
+}
+
+// RequireRole returns a middleware that only allows requests whose principal
+// (see RequestPrincipal) belongs to at least one of the provided roles. It
+// responds to other requests the same way as RequireScopes.
+//
+// Example:
+//
+//     admin := router.Group("/admin", authMiddleware, lmdrouter.RequireRole("admin"))
+//
+func RequireRole(roles ...string) Middleware {
+	return requirePrincipal(func(p Principal) error {
+		for _, role := range roles {
+			if p.HasRole(role) {
+				return nil
+			}
+		}
+
+		return HTTPError{
+			Code: http.StatusForbidden,
+			Message: fmt.Sprintf(
+				"requires one of the roles: %s",
+				strings.Join(roles, ", "),
+			),
+		}
+	})
+}
+
+// requirePrincipal returns a middleware that only allows requests with a
+// principal that passes a check.
+func requirePrincipal(check func(Principal) error) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			p, ok := RequestPrincipal(ctx, req)
+			if !ok {
+				return routerFromContext(ctx).handleError(HTTPError{
+					Code:    http.StatusUnauthorized,
+					Message: "authentication required",
+				})
+			}
+
+			if err := check(p); err != nil {
+				return routerFromContext(ctx).handleError(err)
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
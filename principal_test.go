@@ -0,0 +1,151 @@
+package lmdrouter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestRequestPrincipal(t *testing.T) {
+	t.Run("no principal", func(t *testing.T) {
+		_, ok := RequestPrincipal(context.Background(), events.APIGatewayProxyRequest{})
+		assert.False(t, ok, "Principal must not be found")
+	})
+
+	t.Run("authorizer without principal", func(t *testing.T) {
+		_, ok := RequestPrincipal(context.Background(), events.APIGatewayProxyRequest{
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{"integrationLatency": 12},
+			},
+		})
+		assert.False(t, ok, "Principal must not be found")
+	})
+
+	t.Run("principal in context", func(t *testing.T) {
+		ctx := WithPrincipal(context.Background(), Principal{ID: "user-1"})
+		p, ok := RequestPrincipal(ctx, events.APIGatewayProxyRequest{
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{"principalId": "user-2"},
+			},
+		})
+		assert.True(t, ok, "Principal must be found")
+		assert.Equal(t, "user-1", p.ID, "Principal from context must take precedence")
+	})
+
+	t.Run("lambda authorizer", func(t *testing.T) {
+		p, ok := RequestPrincipal(context.Background(), events.APIGatewayProxyRequest{
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{
+					"principalId": "user-2",
+					"scope":       "articles:read articles:write",
+					"roles":       "editor,admin",
+				},
+			},
+		})
+		assert.True(t, ok, "Principal must be found")
+		assert.Equal(t, "user-2", p.ID, "ID must be correct")
+		assert.DeepEqual(t, []string{"articles:read", "articles:write"}, p.Scopes, "Scopes must be correct")
+		assert.DeepEqual(t, []string{"editor", "admin"}, p.Roles, "Roles must be correct")
+	})
+
+	t.Run("cognito authorizer", func(t *testing.T) {
+		p, ok := RequestPrincipal(context.Background(), events.APIGatewayProxyRequest{
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]interface{}{
+					"claims": map[string]interface{}{
+						"sub":            "user-3",
+						"cognito:groups": "[admin users]",
+					},
+				},
+			},
+		})
+		assert.True(t, ok, "Principal must be found")
+		assert.Equal(t, "user-3", p.ID, "ID must be correct")
+		assert.DeepEqual(t, []string{"admin", "users"}, p.Roles, "Roles must be correct")
+		assert.True(t, p.HasRole("admin"), "Principal must have role")
+		assert.False(t, p.HasScope("articles:read"), "Principal must not have scope")
+	})
+}
+
+func TestRequireScopesAndRole(t *testing.T) {
+	lmd := NewRouter("/api")
+	lmd.Route("POST", "/articles", getSomething, RequireScopes("articles:read", "articles:write"))
+	lmd.Route("DELETE", "/articles", getSomething, RequireRole("admin", "editor"))
+	lmd.Route("GET", "/keys", getSomething, APIKeyMiddleware(APIKeyOptions{
+		Store: StaticAPIKeys{HashAPIKey("key"): {ID: "acme", Scopes: []string{"keys:read"}}},
+	}), RequireScopes("keys:read"))
+
+	call := func(method, path string, reqCtx events.APIGatewayProxyRequestContext, headers map[string]string) events.APIGatewayProxyResponse {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod:     method,
+			Path:           path,
+			Headers:        headers,
+			RequestContext: reqCtx,
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		return res
+	}
+
+	authorizer := func(claims map[string]interface{}) events.APIGatewayProxyRequestContext {
+		return events.APIGatewayProxyRequestContext{Authorizer: claims}
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		res := call("POST", "/api/articles", events.APIGatewayProxyRequestContext{}, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "Status code must be 401")
+	})
+
+	t.Run("authorizer without principal", func(t *testing.T) {
+		res := call("POST", "/api/articles", authorizer(map[string]interface{}{
+			"integrationLatency": 12,
+		}), nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "Status code must be 401")
+	})
+
+	t.Run("missing scope", func(t *testing.T) {
+		res := call("POST", "/api/articles", authorizer(map[string]interface{}{
+			"principalId": "user-1",
+			"scope":       "articles:read",
+		}), nil)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode, "Status code must be 403")
+
+		var httpErr HTTPError
+		err := json.Unmarshal([]byte(res.Body), &httpErr)
+		assert.Equal(t, nil, err, "Body must be valid JSON")
+		assert.Equal(t, http.StatusForbidden, httpErr.Code, "Body must include code")
+		assert.Equal(t, "missing required scope(s): articles:write", httpErr.Message, "Body must include message")
+	})
+
+	t.Run("all scopes", func(t *testing.T) {
+		res := call("POST", "/api/articles", authorizer(map[string]interface{}{
+			"principalId": "user-1",
+			"scope":       "articles:write articles:read",
+		}), nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		res := call("DELETE", "/api/articles", authorizer(map[string]interface{}{
+			"principalId": "user-1",
+			"roles":       "viewer",
+		}), nil)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode, "Status code must be 403")
+
+		res = call("DELETE", "/api/articles", authorizer(map[string]interface{}{
+			"principalId": "user-1",
+			"roles":       []interface{}{"viewer", "editor"},
+		}), nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+	})
+
+	t.Run("principal from auth middleware", func(t *testing.T) {
+		res := call("GET", "/api/keys", events.APIGatewayProxyRequestContext{}, map[string]string{
+			"X-Api-Key": "key",
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+	})
+}
@@ -0,0 +1,106 @@
+package lmdrouter
+
+import (
+	"context"
+	"fmt"
+	stdlog "log"
+	"runtime/debug"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// PanicError is the error generated by RecoveryMiddleware when a handler
+// panics. It is passed to the router's error handler, which may use it to
+// customize the response.
+type PanicError struct {
+	// Value is the value the handler panicked with.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value the handler panicked with, if it is an error.
+func (e PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// RecoveryOptions modify the behavior of RecoveryMiddleware.
+type RecoveryOptions struct {
+	// Logger is used to log panics along with their stack traces. If nil,
+	// the standard logger of the log package is used.
+	Logger *stdlog.Logger
+
+	// Report, if not nil, is called for every panic, e.g. in order to report
+	// it to an error tracker.
+	Report func(ctx context.Context, req events.APIGatewayProxyRequest, err PanicError)
+}
+
+// RecoveryMiddleware returns a middleware that recovers from panics in the
+// middleware and handlers that follow it in the chain, which would otherwise
+// crash the lambda invocation (or drop the connection when using ServeHTTP).
+// Panics are logged with their stack trace and the matched route, reported
+// via the Report hook, and converted into a 500 Internal Server Error
+// response by the router's error handler, which receives a PanicError. It
+// should be the first global middleware of the router.
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter(
+//         "/api",
+//         lmdrouter.RecoveryMiddleware(lmdrouter.RecoveryOptions{
+//             Report: func(ctx context.Context, req events.APIGatewayProxyRequest, err lmdrouter.PanicError) {
+//                 sentry.CaptureException(err)
+//             },
+//         }),
+//         loggerMiddleware,
+//     )
+//
+func RecoveryMiddleware(opts RecoveryOptions) Middleware {
+	if opts.Logger == nil {
+		opts.Logger = stdlog.Default()
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+
+				panicErr := PanicError{
+					Value: recovered,
+					Stack: debug.Stack(),
+				}
+
+				route := req.Path
+				if info, ok := RouteFromContext(ctx); ok {
+					route = info.Pattern
+				}
+
+				opts.Logger.Printf(
+					"[PANIC] [%s %s] %v\n%s",
+					req.HTTPMethod, route, recovered, panicErr.Stack,
+				)
+
+				if opts.Report != nil {
+					opts.Report(ctx, req, panicErr)
+				}
+
+				res, err = routerFromContext(ctx).handleError(panicErr)
+			}()
+
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lmdrouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	stdlog "log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	var reported []PanicError
+
+	lmd := NewRouter("/api", RecoveryMiddleware(RecoveryOptions{
+		Logger: stdlog.New(&logs, "", 0),
+		Report: func(_ context.Context, _ events.APIGatewayProxyRequest, err PanicError) {
+			reported = append(reported, err)
+		},
+	}))
+	lmd.ErrorHandler = func(err error) (events.APIGatewayProxyResponse, error) {
+		var panicErr PanicError
+		if errors.As(err, &panicErr) {
+			return MarshalResponse(http.StatusInternalServerError, nil, HTTPError{
+				Code:    http.StatusInternalServerError,
+				Message: "unexpected error",
+			})
+		}
+		return HandleError(err)
+	}
+	lmd.Route("GET", "/:id", panickingHandler)
+	lmd.Route("GET", "/", listSomethings)
+
+	res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/api/bla",
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "Status code must be 500")
+	assert.Equal(t, `{"code":500,"message":"unexpected error"}`, res.Body, "Error handler must be used")
+
+	assert.Equal(t, 1, len(reported), "Panic must be reported")
+	assert.Equal(t, "panic: something went wrong with bla", reported[0].Error(), "Panic value must be reported")
+	assert.True(t, strings.Contains(string(reported[0].Stack), "panickingHandler"), "Stack trace must be reported")
+
+	assert.True(
+		t,
+		strings.HasPrefix(logs.String(), "[PANIC] [GET /api/:id] something went wrong with bla\n"),
+		"Panic must be logged with route",
+	)
+	assert.True(t, strings.Contains(logs.String(), "panickingHandler"), "Stack trace must be logged")
+
+	res, err = lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/api",
+	})
+	assert.Equal(t, nil, err, "Error must be nil")
+	assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+	assert.Equal(t, 1, len(reported), "Successful requests must not be reported")
+}
+
+func panickingHandler(_ context.Context, req events.APIGatewayProxyRequest) (
+	events.APIGatewayProxyResponse,
+	error,
+) {
+	panic("something went wrong with " + req.PathParameters["id"])
+}
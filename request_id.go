@@ -0,0 +1,182 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// RequestIDOptions modify the behavior of RequestIDMiddleware.
+type RequestIDOptions struct {
+	// Header is the name of the response header that the request ID is
+	// echoed in. If empty, "X-Request-Id" is used.
+	Header string
+
+	// Generate generates request IDs for requests that do not have one. If
+	// nil, random UUIDs are generated.
+	Generate func() string
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request with the provided
+// context, as determined by RequestIDMiddleware.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// RequestIDMiddleware returns a middleware that determines a correlation ID
+// for every request, so that errors reported by clients can be matched with
+// log entries. The ID is taken from the request's "X-Request-Id" or
+// "X-Amzn-Trace-Id" header, or from the request ID of the API Gateway request
+// context. If none of these is available, an ID is generated. IDs taken from
+// headers are ignored if they are longer than 128 characters or include
+// characters other than ASCII letters, digits and "-_.:;=+/@", so that
+// clients cannot inject arbitrary data into logs, headers and responses.
+//
+// The ID is stored in the request's context, where it can be retrieved with
+// RequestIDFromContext (AccessLogMiddleware includes it in its records), and
+// is echoed in a header of the response. Error responses generated by
+// HandleError include it in a "request_id" field of their body, e.g.
+// `{ "code": 500, "message": "something failed", "request_id": "..." }`.
+// The middleware should be the first global middleware of the router, so
+// that all other middleware can use the ID. To include the ID in the 404 and
+// 405 error responses of requests that do not match any route, add the
+// middleware to the router's UnmatchedMiddleware as well.
+//
+// Example:
+//
+//     requestID := lmdrouter.RequestIDMiddleware(lmdrouter.RequestIDOptions{})
+//     router := lmdrouter.NewRouter(
+//         "/api",
+//         requestID,
+//         lmdrouter.AccessLogMiddleware(lmdrouter.AccessLogOptions{}),
+//     )
+//     router.UnmatchedMiddleware = []lmdrouter.Middleware{requestID}
+//
+func RequestIDMiddleware(opts RequestIDOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "X-Request-Id"
+	}
+	if opts.Generate == nil {
+		opts.Generate = newUUID
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			id := headerValue(req.Headers, "X-Request-Id")
+			if !validRequestID(id) {
+				id = headerValue(req.Headers, "X-Amzn-Trace-Id")
+			}
+			if !validRequestID(id) {
+				id = req.RequestContext.RequestID
+			}
+			if id == "" {
+				id = opts.Generate()
+			}
+
+			ctx = context.WithValue(ctx, requestIDKey{}, id)
+
+			res, err = next(ctx, req)
+			if err != nil {
+				return res, err
+			}
+
+			headers := make(map[string]string, len(res.Headers)+1)
+			for key, value := range res.Headers {
+				headers[key] = value
+			}
+			if !hasHeader(headers, opts.Header) {
+				headers[opts.Header] = id
+			}
+			res.Headers = headers
+
+			return addRequestIDToError(res, id), nil
+		}
+	}
+}
+
+// maxRequestIDLength is the maximum length of request IDs taken from request
+// headers.
+const maxRequestIDLength = 128
+
+// validRequestID returns true if id is a non-empty request ID of at most
+// maxRequestIDLength characters, consisting only of ASCII letters, digits and
+// the characters "-_.:;=+/@".
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.:;=+/@", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// addRequestIDToError adds a "request_id" field to the body of error
+// responses generated by HandleError, i.e. JSON objects with a "code" field
+// matching the response's status code and a "message" field. Other responses
+// are returned unmodified.
+func addRequestIDToError(
+	res events.APIGatewayProxyResponse,
+	id string,
+) events.APIGatewayProxyResponse {
+	if res.StatusCode < 400 || res.IsBase64Encoded ||
+		len(res.Body) == 0 || res.Body[0] != '{' {
+		return res
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(res.Body), &body); err != nil {
+		return res
+	}
+
+	code, ok := body["code"].(float64)
+	if !ok || int(code) != res.StatusCode {
+		return res
+	}
+	if _, ok := body["message"].(string); !ok {
+		return res
+	}
+	if _, ok := body["request_id"]; ok {
+		return res
+	}
+
+	body["request_id"] = id
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return res
+	}
+
+	res.Body = string(data)
+	return res
+}
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed generating random bytes: %s", err))
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,130 @@
+package lmdrouter
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	lmd := NewRouter("/api", RequestIDMiddleware(RequestIDOptions{}))
+	lmd.Route("GET", "/:id", func(ctx context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		if req.PathParameters["id"] == "missing" {
+			return HandleError(HTTPError{http.StatusNotFound, "No such item"})
+		}
+		id, _ := RequestIDFromContext(ctx)
+		return MarshalResponse(http.StatusOK, nil, map[string]string{"request_id": id})
+	})
+
+	call := func(path string, headers map[string]string, apigwID string) events.APIGatewayProxyResponse {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       path,
+			Headers:    headers,
+			RequestContext: events.APIGatewayProxyRequestContext{
+				RequestID: apigwID,
+			},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		return res
+	}
+
+	t.Run("X-Request-Id header", func(t *testing.T) {
+		res := call("/api/bla", map[string]string{
+			"x-request-id":    "client-id",
+			"X-Amzn-Trace-Id": "Root=1-5759e988-bd862e3fe1be46a994272793",
+		}, "apigw-id")
+		assert.Equal(t, `{"request_id":"client-id"}`, res.Body, "ID must be stored in context")
+		assert.Equal(t, "client-id", res.Headers["X-Request-Id"], "ID must be echoed")
+	})
+
+	t.Run("X-Amzn-Trace-Id header", func(t *testing.T) {
+		res := call("/api/bla", map[string]string{
+			"X-Amzn-Trace-Id": "Root=1-5759e988-bd862e3fe1be46a994272793",
+		}, "apigw-id")
+		assert.Equal(t, "Root=1-5759e988-bd862e3fe1be46a994272793", res.Headers["X-Request-Id"], "Trace ID must be used")
+	})
+
+	t.Run("API Gateway request ID", func(t *testing.T) {
+		res := call("/api/bla", nil, "apigw-id")
+		assert.Equal(t, "apigw-id", res.Headers["X-Request-Id"], "API Gateway request ID must be used")
+	})
+
+	t.Run("generated ID", func(t *testing.T) {
+		res := call("/api/bla", nil, "")
+		assert.True(
+			t,
+			regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).
+				MatchString(res.Headers["X-Request-Id"]),
+			"Generated ID must be a UUID",
+		)
+	})
+
+	t.Run("error bodies", func(t *testing.T) {
+		res := call("/api/missing", nil, "apigw-id")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+		assert.Equal(
+			t,
+			`{"code":404,"message":"No such item","request_id":"apigw-id"}`,
+			res.Body,
+			"Error body must include the request ID",
+		)
+	})
+
+	t.Run("unmatched requests", func(t *testing.T) {
+		res := call("/api/bla/bla", nil, "apigw-id")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+		assert.Equal(t, "", res.Headers["X-Request-Id"], "Global middleware must not be executed")
+
+		lmd.UnmatchedMiddleware = []Middleware{RequestIDMiddleware(RequestIDOptions{})}
+		defer func() { lmd.UnmatchedMiddleware = nil }()
+
+		res = call("/api/bla/bla", nil, "apigw-id")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+		assert.Equal(t, "apigw-id", res.Headers["X-Request-Id"], "ID must be echoed")
+		assert.Equal(
+			t,
+			`{"code":404,"message":"No such resource","request_id":"apigw-id"}`,
+			res.Body,
+			"Error body must include the request ID",
+		)
+	})
+
+	t.Run("invalid client IDs", func(t *testing.T) {
+		for name, id := range map[string]string{
+			"too long":          strings.Repeat("a", 129),
+			"invalid character": "id\r\nSet-Cookie: session=evil",
+			"non-ASCII":         "идентификатор",
+			"JSON":              `","admin":true,"x":"`,
+		} {
+			res := call("/api/bla", map[string]string{"X-Request-Id": id}, "apigw-id")
+			assert.Equal(t, "apigw-id", res.Headers["X-Request-Id"], "Invalid ID must be replaced for "+name)
+
+			res = call("/api/bla", map[string]string{"X-Request-Id": id}, "")
+			assert.NotEqual(t, id, res.Headers["X-Request-Id"], "Invalid ID must be replaced for "+name)
+			assert.Equal(t, 36, len(res.Headers["X-Request-Id"]), "ID must be generated for "+name)
+		}
+
+		maxLength := strings.Repeat("a", 128)
+		res := call("/api/bla", map[string]string{"X-Request-Id": maxLength}, "apigw-id")
+		assert.Equal(t, maxLength, res.Headers["X-Request-Id"], "IDs of maximum length must be used")
+	})
+
+	t.Run("custom header", func(t *testing.T) {
+		handler := RequestIDMiddleware(RequestIDOptions{
+			Header:   "X-Correlation-Id",
+			Generate: func() string { return "generated" },
+		})(getSomething)
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, "generated", res.Headers["X-Correlation-Id"], "ID must be echoed in custom header")
+	})
+}
@@ -0,0 +1,351 @@
+package lmdrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Iterator is a function that returns the items of a collection one by one.
+// It returns false when the collection is exhausted, and a non-nil error if
+// retrieving the next item failed.
+type Iterator[T any] func() (item T, ok bool, err error)
+
+// ChannelIterator creates an Iterator that receives items from a channel,
+// until the channel is closed.
+func ChannelIterator[T any](ch <-chan T) Iterator[T] {
+	return func() (item T, ok bool, err error) {
+		item, ok = <-ch
+		return item, ok, nil
+	}
+}
+
+// SliceIterator creates an Iterator over the items of a slice.
+func SliceIterator[T any](items []T) Iterator[T] {
+	return func() (item T, ok bool, err error) {
+		if len(items) == 0 {
+			return item, false, nil
+		}
+
+		item, items = items[0], items[1:]
+		return item, true, nil
+	}
+}
+
+// StreamFormat is a format in which a collection of items is encoded by
+// JSONStream.
+type StreamFormat int
+
+const (
+	// JSONArray encodes a collection as a single JSON array.
+	JSONArray StreamFormat = iota
+
+	// NDJSON encodes a collection as newline-delimited JSON, with every item
+	// encoded as a JSON value in its own line.
+	NDJSON
+)
+
+// ContentType returns the value of the "Content-Type" header for responses
+// encoded in the format.
+func (f StreamFormat) ContentType() string {
+	if f == NDJSON {
+		return "application/x-ndjson; charset=UTF-8"
+	}
+
+	return "application/json; charset=UTF-8"
+}
+
+// JSONStream creates a reader that encodes the items returned by an Iterator
+// in the provided format. Items are retrieved and encoded incrementally as
+// the reader is read, so the collection is never held in memory in its
+// entirety. If the iterator or the encoding of an item fails, the reader
+// returns the error after all data encoded so far was read, meaning the
+// output will be truncated.
+func JSONStream[T any](format StreamFormat, next Iterator[T]) io.Reader {
+	return &jsonStream[T]{format: format, next: next}
+}
+
+type jsonStream[T any] struct {
+	format  StreamFormat
+	next    Iterator[T]
+	buf     bytes.Buffer
+	count   int
+	started bool
+	err     error
+}
+
+func (s *jsonStream[T]) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 && s.err == nil {
+		s.fill()
+	}
+
+	if s.buf.Len() > 0 {
+		return s.buf.Read(p)
+	}
+
+	return 0, s.err
+}
+
+// fill encodes the next item of the collection into the stream's buffer. When
+// the collection is exhausted, the stream's error is set to io.EOF.
+func (s *jsonStream[T]) fill() {
+	if !s.started && s.format == JSONArray {
+		s.buf.WriteByte('[')
+	}
+	s.started = true
+
+	item, ok, err := s.next()
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	if !ok {
+		if s.format == JSONArray {
+			s.buf.WriteByte(']')
+		}
+		s.err = io.EOF
+		return
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	if s.format == JSONArray && s.count > 0 {
+		s.buf.WriteByte(',')
+	}
+	s.buf.Write(data)
+	if s.format == NDJSON {
+		s.buf.WriteByte('\n')
+	}
+	s.count++
+}
+
+type streamKey struct{}
+
+// streamSlot holds the body of a streamed response, which is set by
+// StreamResponse if the request is handled by an entry point that supports
+// streaming (ServeHTTP or StreamingHandler).
+type streamSlot struct {
+	body io.Reader
+}
+
+func withStreaming(ctx context.Context) (context.Context, *streamSlot) {
+	slot := &streamSlot{}
+	return context.WithValue(ctx, streamKey{}, slot), slot
+}
+
+// isStreamed returns true if the response to the request with the provided
+// context is streamed, in which case middleware must not modify its body.
+func isStreamed(ctx context.Context) bool {
+	slot, ok := ctx.Value(streamKey{}).(*streamSlot)
+	return ok && slot.body != nil
+}
+
+// StreamResponse generates a response whose body is read from a reader. If
+// the request is handled by an entry point that supports streaming (i.e. the
+// router's ServeHTTP method, which uses chunked writes, or its
+// StreamingHandler method, which uses Lambda response streaming), the body is
+// streamed to the client as it is read, and the returned response has an
+// empty body. Otherwise, the reader is read in its entirety, as in Stream.
+// If the reader is also an io.Closer, it is closed once read.
+//
+// Middleware that modify response bodies, such as CompressionMiddleware and
+// ETagMiddleware, leave streamed responses untouched.
+func StreamResponse(
+	ctx context.Context,
+	status int,
+	headers map[string]string,
+	body io.Reader,
+) (events.APIGatewayProxyResponse, error) {
+	res := events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    make(map[string]string, len(headers)),
+	}
+	for key, value := range headers {
+		res.Headers[key] = value
+	}
+
+	if slot, ok := ctx.Value(streamKey{}).(*streamSlot); ok {
+		slot.body = body
+		return res, nil
+	}
+
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close() // nolint: errcheck
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return HandleError(fmt.Errorf("failed reading response body: %w", err))
+	}
+
+	if isTextContentType(headerValue(res.Headers, "Content-Type")) {
+		res.Body = string(data)
+	} else {
+		res.IsBase64Encoded = true
+		res.Body = base64.StdEncoding.EncodeToString(data)
+	}
+
+	return res, nil
+}
+
+// StreamJSON generates a response whose body is a collection of items
+// encoded as a JSON array or as newline-delimited JSON, and sets the
+// "Content-Type" header accordingly (unless already provided). Items are
+// encoded incrementally (see JSONStream), and streamed to the client if
+// possible (see StreamResponse).
+//
+// Example:
+//
+//     rows, err := db.QueryContext(ctx, "SELECT id, name FROM items")
+//     if err != nil {
+//         return lmdrouter.HandleError(err)
+//     }
+//
+//     return lmdrouter.StreamJSON(ctx, http.StatusOK, nil, lmdrouter.NDJSON,
+//         func() (item Item, ok bool, err error) {
+//             if !rows.Next() {
+//                 return item, false, rows.Close()
+//             }
+//             return item, true, rows.Scan(&item.ID, &item.Name)
+//         },
+//     )
+//
+func StreamJSON[T any](
+	ctx context.Context,
+	status int,
+	headers map[string]string,
+	format StreamFormat,
+	next Iterator[T],
+) (events.APIGatewayProxyResponse, error) {
+	if !hasHeader(headers, "Content-Type") {
+		withType := make(map[string]string, len(headers)+1)
+		for key, value := range headers {
+			withType[key] = value
+		}
+		withType["Content-Type"] = format.ContentType()
+		headers = withType
+	}
+
+	return StreamResponse(ctx, status, headers, JSONStream(format, next))
+}
+
+// StreamingHandler is the same as Handler, but handles requests sent through
+// a Lambda function URL, and returns a response that supports Lambda response
+// streaming, so that bodies generated by StreamResponse and StreamJSON are
+// streamed to the client as they are generated. Function URL requests are
+// converted into API Gateway proxy requests (see ProxyRequestFromURL), so
+// handlers and middleware are the same for both. This method must be
+// provided to the lambda's `main` function instead of Handler, and the
+// function URL must be configured with the RESPONSE_STREAM invoke mode:
+//
+//     func main() {
+//         lambda.Start(router.StreamingHandler)
+//     }
+//
+func (l *Router) StreamingHandler(
+	ctx context.Context,
+	urlReq events.LambdaFunctionURLRequest,
+) (*events.LambdaFunctionURLStreamingResponse, error) {
+	req := ProxyRequestFromURL(urlReq)
+	ctx, slot := withStreaming(ctx)
+
+	res, err := l.Handler(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	body := slot.body
+	if body == nil {
+		data := []byte(res.Body)
+		if res.IsBase64Encoded {
+			data, err = base64.StdEncoding.DecodeString(res.Body)
+			if err != nil {
+				return nil, fmt.Errorf("handler returned invalid base64 data: %w", err)
+			}
+		}
+		body = bytes.NewReader(data)
+	}
+
+	headers := make(map[string]string, len(res.Headers))
+	for key, value := range res.Headers {
+		headers[key] = value
+	}
+	for key, values := range res.MultiValueHeaders {
+		if len(values) > 0 && !hasHeader(headers, key) {
+			headers[key] = values[0]
+		}
+	}
+
+	return &events.LambdaFunctionURLStreamingResponse{
+		StatusCode: res.StatusCode,
+		Headers:    headers,
+		Body:       body,
+	}, nil
+}
+
+// ProxyRequestFromURL converts a request sent through a Lambda function URL
+// (which uses the version 2.0 payload format) into an API Gateway proxy
+// request, as expected by Handler. Cookies are joined into a "Cookie" header,
+// and the multi-value query string parameters are parsed from the raw query
+// string. Function URLs join multiple values of the same header with commas,
+// so MultiValueHeaders only includes single values.
+func ProxyRequestFromURL(req events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+	headers := make(map[string]string, len(req.Headers)+1)
+	multiHeaders := make(map[string][]string, len(req.Headers)+1)
+	for key, value := range req.Headers {
+		headers[key] = value
+		multiHeaders[key] = []string{value}
+	}
+	if len(req.Cookies) > 0 && !hasHeader(headers, "Cookie") {
+		headers["cookie"] = strings.Join(req.Cookies, "; ")
+		multiHeaders["cookie"] = []string{headers["cookie"]}
+	}
+
+	query := req.QueryStringParameters
+	var multiQuery map[string][]string
+	if parsed, err := url.ParseQuery(req.RawQueryString); err == nil && len(parsed) > 0 {
+		multiQuery = map[string][]string(parsed)
+		query = make(map[string]string, len(parsed))
+		for key, values := range parsed {
+			query[key] = values[len(values)-1]
+		}
+	}
+
+	reqCtx := req.RequestContext
+	return events.APIGatewayProxyRequest{
+		Path:                            req.RawPath,
+		HTTPMethod:                      reqCtx.HTTP.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               multiHeaders,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: multiQuery,
+		Body:                            req.Body,
+		IsBase64Encoded:                 req.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  reqCtx.AccountID,
+			RequestID:  reqCtx.RequestID,
+			APIID:      reqCtx.APIID,
+			DomainName: reqCtx.DomainName,
+			Protocol:   reqCtx.HTTP.Protocol,
+			HTTPMethod: reqCtx.HTTP.Method,
+			Path:       reqCtx.HTTP.Path,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  reqCtx.HTTP.SourceIP,
+				UserAgent: reqCtx.HTTP.UserAgent,
+			},
+			RequestTimeEpoch: reqCtx.TimeEpoch,
+		},
+	}
+}
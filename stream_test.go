@@ -0,0 +1,206 @@
+package lmdrouter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+type mockStreamItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestJSONStream(t *testing.T) {
+	items := []mockStreamItem{{1, "one"}, {2, "two"}, {3, "three"}}
+
+	t.Run("JSON array", func(t *testing.T) {
+		data, err := io.ReadAll(JSONStream(JSONArray, SliceIterator(items)))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(
+			t,
+			`[{"id":1,"name":"one"},{"id":2,"name":"two"},{"id":3,"name":"three"}]`,
+			string(data),
+			"Output must be correct",
+		)
+	})
+
+	t.Run("empty JSON array", func(t *testing.T) {
+		data, err := io.ReadAll(JSONStream(JSONArray, SliceIterator([]mockStreamItem{})))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, `[]`, string(data), "Output must be correct")
+	})
+
+	t.Run("NDJSON from channel", func(t *testing.T) {
+		ch := make(chan mockStreamItem)
+		go func() {
+			for _, item := range items {
+				ch <- item
+			}
+			close(ch)
+		}()
+
+		data, err := io.ReadAll(JSONStream(NDJSON, ChannelIterator(ch)))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(
+			t,
+			"{\"id\":1,\"name\":\"one\"}\n{\"id\":2,\"name\":\"two\"}\n{\"id\":3,\"name\":\"three\"}\n",
+			string(data),
+			"Output must be correct",
+		)
+	})
+
+	t.Run("failing iterator", func(t *testing.T) {
+		i := 0
+		data, err := io.ReadAll(JSONStream(JSONArray, func() (item mockStreamItem, ok bool, err error) {
+			i++
+			if i > 1 {
+				return item, false, errors.New("connection lost")
+			}
+			return items[0], true, nil
+		}))
+		assert.NotEqual(t, nil, err, "Error must not be nil")
+		assert.Equal(t, `[{"id":1,"name":"one"}`, string(data), "Output must be truncated")
+	})
+}
+
+func TestStreamJSON(t *testing.T) {
+	items := []mockStreamItem{{1, "one"}, {2, "two"}}
+
+	lmd := NewRouter("/api", CompressionMiddleware(CompressionOptions{MinSize: 1}), ETagMiddleware(ETagOptions{}))
+	lmd.Route("GET", "/items", func(ctx context.Context, _ events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		return StreamJSON(ctx, http.StatusOK, nil, NDJSON, SliceIterator(items))
+	})
+
+	expected := "{\"id\":1,\"name\":\"one\"}\n{\"id\":2,\"name\":\"two\"}\n"
+
+	t.Run("buffered", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/items",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "application/x-ndjson; charset=UTF-8", res.Headers["Content-Type"], "Content-Type must be correct")
+		assert.False(t, res.IsBase64Encoded, "Body must not be base-64 encoded")
+		assert.Equal(t, expected, res.Body, "Body must be correct")
+	})
+
+	t.Run("ServeHTTP", func(t *testing.T) {
+		ts := httptest.NewServer(lmd)
+		defer ts.Close()
+
+		req, _ := http.NewRequest("GET", ts.URL+"/api/items", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		res, err := http.DefaultTransport.RoundTrip(req)
+		assert.Equal(t, nil, err, "Error must be nil")
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "application/x-ndjson; charset=UTF-8", res.Header.Get("Content-Type"), "Content-Type must be correct")
+		assert.Equal(t, "", res.Header.Get("Content-Encoding"), "Streamed response must not be compressed")
+		assert.Equal(t, "", res.Header.Get("ETag"), "Streamed response must not have an ETag")
+		assert.DeepEqual(t, []string{"chunked"}, res.TransferEncoding, "Response must be chunked")
+
+		scanner := bufio.NewScanner(res.Body)
+		var lines []string
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		assert.Equal(t, expected, strings.Join(lines, "\n")+"\n", "Body must be correct")
+	})
+
+	t.Run("StreamingHandler", func(t *testing.T) {
+		res, err := lmd.StreamingHandler(context.Background(), functionURLEvent(t, "GET", "/api/items"))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, "application/x-ndjson; charset=UTF-8", res.Headers["Content-Type"], "Content-Type must be correct")
+
+		data, err := io.ReadAll(res.Body)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, expected, string(data), "Body must be correct")
+	})
+
+	t.Run("StreamingHandler with regular response", func(t *testing.T) {
+		res, err := lmd.StreamingHandler(context.Background(), functionURLEvent(t, "GET", "/api/nothing"))
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+
+		data, err := io.ReadAll(res.Body)
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, `{"code":404,"message":"No such resource"}`, string(data), "Body must be correct")
+	})
+}
+
+func TestProxyRequestFromURL(t *testing.T) {
+	req := ProxyRequestFromURL(functionURLEvent(t, "POST", "/api/items"))
+
+	assert.Equal(t, "POST", req.HTTPMethod, "Method must be converted")
+	assert.Equal(t, "/api/items", req.Path, "Path must be converted")
+	assert.Equal(t, "application/json", headerValue(req.Headers, "Content-Type"), "Headers must be converted")
+	assert.Equal(t, "session=abc; theme=dark", headerValue(req.Headers, "Cookie"), "Cookies must be converted")
+	assert.Equal(t, "b", req.QueryStringParameters["tag"], "Last query value must be used")
+	assert.DeepEqual(t, []string{"a", "b"}, req.MultiValueQueryStringParameters["tag"], "Multiple query values must be converted")
+	assert.Equal(t, `{"name":"four"}`, req.Body, "Body must be converted")
+	assert.Equal(t, "c6af9ac6-7b61-11e6-9a41-93e8deadbeef", req.RequestContext.RequestID, "Request ID must be converted")
+	assert.Equal(t, "198.51.100.7", req.RequestContext.Identity.SourceIP, "Source IP must be converted")
+	assert.Equal(t, "curl/8.4.0", req.RequestContext.Identity.UserAgent, "User agent must be converted")
+}
+
+// functionURLEvent decodes a Lambda function URL event, in the payload format
+// sent by AWS, with the provided method and path.
+func functionURLEvent(t *testing.T, method, path string) events.LambdaFunctionURLRequest {
+	payload := fmt.Sprintf(`{
+		"version": "2.0",
+		"routeKey": "$default",
+		"rawPath": %q,
+		"rawQueryString": "tag=a&tag=b",
+		"cookies": ["session=abc", "theme=dark"],
+		"headers": {
+			"content-type": "application/json",
+			"host": "abcdefg.lambda-url.us-east-1.on.aws",
+			"user-agent": "curl/8.4.0",
+			"x-amzn-trace-id": "Root=1-5759e988-bd862e3fe1be46a994272793"
+		},
+		"queryStringParameters": {"tag": "a,b"},
+		"requestContext": {
+			"accountId": "123456789012",
+			"apiId": "abcdefg",
+			"domainName": "abcdefg.lambda-url.us-east-1.on.aws",
+			"domainPrefix": "abcdefg",
+			"http": {
+				"method": %q,
+				"path": %q,
+				"protocol": "HTTP/1.1",
+				"sourceIp": "198.51.100.7",
+				"userAgent": "curl/8.4.0"
+			},
+			"requestId": "c6af9ac6-7b61-11e6-9a41-93e8deadbeef",
+			"routeKey": "$default",
+			"stage": "$default",
+			"time": "12/Mar/2024:19:03:58 +0000",
+			"timeEpoch": 1710270238000
+		},
+		"body": "{\"name\":\"four\"}",
+		"isBase64Encoded": false
+	}`, path, method, path)
+
+	var req events.LambdaFunctionURLRequest
+	err := json.Unmarshal([]byte(payload), &req)
+	assert.Equal(t, nil, err, "Event must be valid")
+
+	return req
+}
@@ -1,6 +1,11 @@
 package lmdrouter
 
-import "time"
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
 
 type mockConst string
 
@@ -51,3 +56,69 @@ type mockItem struct {
 	Name string
 	Date time.Time
 }
+
+type mockUpper string
+
+func (u *mockUpper) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("empty value")
+	}
+
+	*u = mockUpper(strings.ToUpper(string(text)))
+	return nil
+}
+
+type mockPoint struct {
+	X int
+	Y int
+}
+
+type mockCustomRequest struct {
+	Upper    mockUpper     `lambda:"query.upper"`
+	PUpper   *mockUpper    `lambda:"query.pupper"`
+	Uppers   []mockUpper   `lambda:"query.uppers"`
+	Point    mockPoint     `lambda:"query.point"`
+	PPoint   *mockPoint    `lambda:"query.ppoint"`
+	Timeout  time.Duration `lambda:"query.timeout"`
+	IP       net.IP        `lambda:"header.X-Forwarded-For"`
+	Time     time.Time     `lambda:"query.time"`
+	Date     time.Time     `lambda:"query.date" layout:"2006-01-02"`
+	PDate    *time.Time    `lambda:"query.pdate" layout:"02/01/2006"`
+	NotGiven time.Time     `lambda:"query.not_given"`
+}
+
+type mockDefaultsRequest struct {
+	Tenant string   `lambda:"header.X-Tenant,required"`
+	Page   int64    `lambda:"query.page,default=1"`
+	Order  *string  `lambda:"query.order,default=asc"`
+	Sort   []string `lambda:"query.sort,default=name,-date"`
+	Filter string   `lambda:"query.filter,required,default=all"`
+}
+
+type mockScalarsRequest struct {
+	Int8     int8       `lambda:"query.int8"`
+	Uint16   uint16     `lambda:"query.uint16"`
+	Float32  float32    `lambda:"query.float32"`
+	PInt     *int       `lambda:"query.pint"`
+	PInt8    *int8      `lambda:"query.pint8"`
+	PUint64  *uint64    `lambda:"query.puint64"`
+	PFloat32 *float32   `lambda:"query.pfloat32"`
+	PString  *string    `lambda:"query.pstring"`
+	Ints     []int      `lambda:"query.ints"`
+	Floats   []float64  `lambda:"query.floats"`
+	Uints    []uint8    `lambda:"query.uints"`
+	Bools    []bool     `lambda:"query.bools"`
+	PInts    []*int     `lambda:"query.pints"`
+	Array    [3]int     `lambda:"query.array"`
+	PStrings []*string  `lambda:"query.pstrings"`
+	Weights  [2]float32 `lambda:"header.X-Weights"`
+}
+
+type mockFilterRequest struct {
+	Filter   map[string]string  `lambda:"query.filter"`
+	Ranges   map[string][]int   `lambda:"query.range"`
+	Flags    map[string]*bool   `lambda:"query.flags,required"`
+	IDs      []int              `lambda:"query.ids"`
+	Tags     []string           `lambda:"query.tags"`
+	Optional map[string]float64 `lambda:"query.optional"`
+}
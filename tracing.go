@@ -0,0 +1,176 @@
+package lmdrouter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aquasecurity/lmdrouter"
+
+// TracingOptions modify the behavior of TracingMiddleware.
+type TracingOptions struct {
+	// TracerProvider provides the tracer spans are created with. If nil, the
+	// global provider (see otel.GetTracerProvider) is used.
+	TracerProvider trace.TracerProvider
+
+	// Propagator extracts the parent span context from request headers. If
+	// nil, W3C Trace Context ("traceparent"), W3C Baggage and AWS X-Ray
+	// ("X-Amzn-Trace-Id") headers are extracted, with Trace Context taking
+	// precedence over X-Ray if both are present.
+	Propagator propagation.TextMapPropagator
+}
+
+// TracingMiddleware returns a middleware that traces requests with
+// OpenTelemetry. A server span is started for every request, as a child of
+// the span context extracted from the request's headers (if any), and named
+// after the request's method and matched route pattern (e.g.
+// "GET /api/posts/:id"), so that spans are grouped by route rather than by
+// path. Spans include HTTP semantic convention attributes such as the method,
+// route, path, status code, client address and user agent. Errors returned by
+// handlers are recorded on the span, and both errors and server error status
+// codes (5xx) mark the span as failed.
+//
+// The span is stored in the request's context, so handlers can retrieve it
+// with trace.SpanFromContext, and outgoing calls made with the context (e.g.
+// via otelhttp or the instrumented AWS SDK) become its children. The
+// middleware should be the first global middleware of the router, so that
+// spans cover all other middleware, including the responses generated by
+// RecoveryMiddleware.
+//
+// Example:
+//
+//     router := lmdrouter.NewRouter(
+//         "/api",
+//         lmdrouter.TracingMiddleware(lmdrouter.TracingOptions{
+//             TracerProvider: tp,
+//         }),
+//         lmdrouter.RecoveryMiddleware(lmdrouter.RecoveryOptions{}),
+//     )
+//
+func TracingMiddleware(opts TracingOptions) Middleware {
+	if opts.Propagator == nil {
+		opts.Propagator = propagation.NewCompositeTextMapPropagator(
+			xray.Propagator{},
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		)
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			provider := opts.TracerProvider
+			if provider == nil {
+				provider = otel.GetTracerProvider()
+			}
+
+			ctx = opts.Propagator.Extract(ctx, headerCarrier(req.Headers))
+
+			name := req.HTTPMethod
+			attrs := requestAttributes(ctx, req)
+			if info, ok := RouteFromContext(ctx); ok {
+				name += " " + info.Pattern
+				attrs = append(attrs, semconv.HTTPRoute(info.Pattern))
+			}
+
+			ctx, span := provider.Tracer(tracerName).Start(
+				ctx,
+				name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+
+			res, err = next(ctx, req)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return res, err
+			}
+
+			span.SetAttributes(
+				semconv.HTTPResponseStatusCode(res.StatusCode),
+				semconv.HTTPResponseBodySize(responseSize(res)),
+			)
+			if res.StatusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+			}
+
+			return res, nil
+		}
+	}
+}
+
+// requestAttributes returns the semantic convention attributes of a request.
+func requestAttributes(
+	ctx context.Context,
+	req events.APIGatewayProxyRequest,
+) []attribute.KeyValue {
+	scheme := headerValue(req.Headers, "X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.HTTPMethod),
+		semconv.URLPath(req.Path),
+		semconv.URLScheme(scheme),
+	}
+
+	if host := headerValue(req.Headers, "Host"); host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+	}
+	if ip := req.RequestContext.Identity.SourceIP; ip != "" {
+		attrs = append(attrs, semconv.ClientAddress(ip))
+	}
+
+	userAgent := req.RequestContext.Identity.UserAgent
+	if userAgent == "" {
+		userAgent = headerValue(req.Headers, "User-Agent")
+	}
+	if userAgent != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(userAgent))
+	}
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		attrs = append(attrs, semconv.FaaSInvocationID(lc.AwsRequestID))
+	}
+
+	return attrs
+}
+
+// headerCarrier adapts the headers of an API Gateway request to the
+// propagation.TextMapCarrier interface, with case-insensitive lookups.
+type headerCarrier map[string]string
+
+// Get implements the propagation.TextMapCarrier interface.
+func (c headerCarrier) Get(key string) string {
+	return headerValue(c, key)
+}
+
+// Set implements the propagation.TextMapCarrier interface.
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys implements the propagation.TextMapCarrier interface.
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,170 @@
+package lmdrouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	var handlerSpan trace.SpanContext
+
+	lmd := NewRouter("/api", TracingMiddleware(TracingOptions{
+		TracerProvider: provider,
+	}))
+	lmd.Route("GET", "/:id", func(ctx context.Context, req events.APIGatewayProxyRequest) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		switch req.PathParameters["id"] {
+		case "fail":
+			return events.APIGatewayProxyResponse{}, errors.New("database unavailable")
+		case "broken":
+			return HandleError(errors.New("something broke"))
+		case "missing":
+			return HandleError(HTTPError{Code: http.StatusNotFound, Message: "not found"})
+		}
+		return MarshalResponse(http.StatusOK, nil, map[string]string{"id": "bla"})
+	})
+
+	attrs := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+		for _, kv := range span.Attributes {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	t.Run("successful request with W3C parent", func(t *testing.T) {
+		exporter.Reset()
+
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla",
+			Headers: map[string]string{
+				"Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"Host":        "api.example.com",
+				"User-Agent":  "test-agent",
+			},
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Identity: events.APIGatewayRequestIdentity{SourceIP: "10.0.0.1"},
+			},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans), "One span must be recorded")
+
+		span := spans[0]
+		assert.Equal(t, "GET /api/:id", span.Name, "Span must be named after route")
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind, "Span must be a server span")
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String(), "Trace ID must be extracted")
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String(), "Parent span must be extracted")
+		assert.True(t, span.Parent.IsRemote(), "Parent span must be remote")
+		assert.Equal(t, span.SpanContext.SpanID(), handlerSpan.SpanID(), "Span must be available to handler")
+		assert.Equal(t, codes.Unset, span.Status.Code, "Status must be unset")
+
+		a := attrs(span)
+		assert.Equal(t, "GET", a["http.request.method"].AsString(), "Method must be recorded")
+		assert.Equal(t, "/api/:id", a["http.route"].AsString(), "Route must be recorded")
+		assert.Equal(t, "/api/bla", a["url.path"].AsString(), "Path must be recorded")
+		assert.Equal(t, "api.example.com", a["server.address"].AsString(), "Host must be recorded")
+		assert.Equal(t, "10.0.0.1", a["client.address"].AsString(), "Client address must be recorded")
+		assert.Equal(t, "test-agent", a["user_agent.original"].AsString(), "User agent must be recorded")
+		assert.Equal(t, int64(200), a["http.response.status_code"].AsInt64(), "Status code must be recorded")
+	})
+
+	t.Run("X-Ray parent", func(t *testing.T) {
+		exporter.Reset()
+
+		_, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla",
+			Headers: map[string]string{
+				"X-Amzn-Trace-Id": "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+			},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans), "One span must be recorded")
+		assert.Equal(t, "5759e988bd862e3fe1be46a994272793", spans[0].SpanContext.TraceID().String(), "Trace ID must be extracted")
+		assert.Equal(t, "53995c3f42cd8ad8", spans[0].Parent.SpanID().String(), "Parent span must be extracted")
+	})
+
+	t.Run("no parent", func(t *testing.T) {
+		exporter.Reset()
+
+		_, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans), "One span must be recorded")
+		assert.False(t, spans[0].Parent.IsValid(), "Span must be a root span")
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		exporter.Reset()
+
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/missing",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans), "One span must be recorded")
+		assert.Equal(t, codes.Unset, spans[0].Status.Code, "Client errors must not fail server spans")
+		assert.Equal(t, int64(404), attrs(spans[0])["http.response.status_code"].AsInt64(), "Status code must be recorded")
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		exporter.Reset()
+
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/broken",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "Status code must be 500")
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans), "One span must be recorded")
+		assert.Equal(t, codes.Error, spans[0].Status.Code, "Status must be error")
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		exporter.Reset()
+
+		_, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/fail",
+		})
+		assert.NotEqual(t, nil, err, "Error must be returned")
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans), "One span must be recorded")
+		assert.Equal(t, codes.Error, spans[0].Status.Code, "Status must be error")
+		assert.Equal(t, "database unavailable", spans[0].Status.Description, "Error must be described")
+		assert.Equal(t, 1, len(spans[0].Events), "Error must be recorded")
+		assert.Equal(t, "exception", spans[0].Events[0].Name, "Error must be recorded as exception")
+	})
+}
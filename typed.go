@@ -0,0 +1,113 @@
+package lmdrouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Validator is an interface that can be implemented by input types of typed
+// handlers (see Typed). The Validate method is called after the input is
+// bound from the request. If it returns an error that is not an HTTPError,
+// the error is converted into a 400 Bad Request HTTPError.
+type Validator interface {
+	Validate() error
+}
+
+// StatusCoder is an interface that can be implemented by output types of
+// typed handlers (see Typed) in order to set the status code of the response.
+// If the output does not implement this interface, 200 OK is used.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Typed creates a Handler from a function that receives an input value and
+// returns an output value, removing the need to manually unmarshal requests,
+// handle errors and marshal responses.
+//
+// The input type must be a struct, which is filled via UnmarshalRequest (if
+// the request has a body, it is unmarshaled into the input as well). If the
+// handler is executed by a Router, the router's DecoderOptions are used. If the
+// input (or a pointer to it) implements Validator, it is validated before fn
+// is called.
+//
+// If binding, validation or fn fail, the error is converted into a response
+// by the router's ErrorHandler (or HandleError, if the router does not have
+// one). Otherwise, the output is marshaled via MarshalResponse, with the
+// status code taken from the output if it implements StatusCoder. If the
+// output is an events.APIGatewayProxyResponse, it is returned as is.
+//
+// Example:
+//
+//     type getPostInput struct {
+//         ID uint64 `lambda:"path.id"`
+//     }
+//
+//     func getPost(ctx context.Context, input getPostInput) (Post, error) {
+//         // ...
+//     }
+//
+//     router.Route("GET", "/:id", lmdrouter.Typed(getPost))
+//
+func Typed[In, Out any](fn func(context.Context, In) (Out, error)) Handler {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+		res events.APIGatewayProxyResponse,
+		err error,
+	) {
+		router := routerFromContext(ctx)
+
+		var opts DecoderOptions
+		if router != nil {
+			opts = router.DecoderOptions
+		}
+
+		var input In
+		err = UnmarshalRequestWithOptions(req, req.Body != "", &input, opts)
+		if err != nil {
+			return router.handleError(err)
+		}
+
+		err = validateInput(&input)
+		if err != nil {
+			return router.handleError(err)
+		}
+
+		output, err := fn(ctx, input)
+		if err != nil {
+			return router.handleError(err)
+		}
+
+		switch out := interface{}(output).(type) {
+		case events.APIGatewayProxyResponse:
+			return out, nil
+		case StatusCoder:
+			return MarshalResponse(out.StatusCode(), nil, output)
+		}
+
+		return MarshalResponse(http.StatusOK, nil, output)
+	}
+}
+
+func validateInput(input interface{}) error {
+	validator, ok := input.(Validator)
+	if !ok {
+		return nil
+	}
+
+	err := validator.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		return err
+	}
+
+	return HTTPError{
+		Code:    http.StatusBadRequest,
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,189 @@
+package lmdrouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+type mockTypedInput struct {
+	ID    string `lambda:"path.id"`
+	Page  int    `lambda:"query.page,default=1"`
+	Title string `json:"title"`
+}
+
+func (input mockTypedInput) Validate() error {
+	if input.Title == "invalid" {
+		return errors.New("title is invalid")
+	}
+	return nil
+}
+
+type mockTypedOutput struct {
+	ID    string `json:"id"`
+	Page  int    `json:"page"`
+	Title string `json:"title"`
+	code  int
+}
+
+func (output mockTypedOutput) StatusCode() int {
+	return output.code
+}
+
+func TestTyped(t *testing.T) {
+	lmd := NewRouter("/api")
+	lmd.Route("GET", "/:id", Typed(func(ctx context.Context, input mockTypedInput) (
+		map[string]interface{},
+		error,
+	) {
+		if input.ID == "missing" {
+			return nil, HTTPError{http.StatusNotFound, "No such item"}
+		}
+		if input.ID == "broken" {
+			return nil, errors.New("database down")
+		}
+		return map[string]interface{}{"id": input.ID, "page": input.Page}, nil
+	}))
+	lmd.Route("PUT", "/:id", Typed(func(ctx context.Context, input mockTypedInput) (
+		mockTypedOutput,
+		error,
+	) {
+		return mockTypedOutput{
+			ID:    input.ID,
+			Page:  input.Page,
+			Title: input.Title,
+			code:  http.StatusAccepted,
+		}, nil
+	}))
+	lmd.Route("DELETE", "/:id", Typed(func(ctx context.Context, input mockTypedInput) (
+		events.APIGatewayProxyResponse,
+		error,
+	) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusNoContent}, nil
+	}))
+
+	t.Run("successful request", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusOK, res.StatusCode, "Status code must be 200")
+		assert.Equal(t, `{"id":"bla","page":1}`, res.Body, "Body must be correct")
+	})
+
+	t.Run("request with body and status code", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "PUT",
+			Path:       "/api/bla",
+			QueryStringParameters: map[string]string{
+				"page": "3",
+			},
+			Body: `{"title":"Fake Post"}`,
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusAccepted, res.StatusCode, "Status code must be 202")
+		assert.Equal(t, `{"id":"bla","page":3,"title":"Fake Post"}`, res.Body, "Body must be correct")
+	})
+
+	t.Run("raw response", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "DELETE",
+			Path:       "/api/bla",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode, "Status code must be 204")
+	})
+
+	t.Run("binding error", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla",
+			QueryStringParameters: map[string]string{
+				"page": "abc",
+			},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "Status code must be 400")
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "PUT",
+			Path:       "/api/bla",
+			Body:       `{"title":"invalid"}`,
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "Status code must be 400")
+		assert.Equal(t, `{"code":400,"message":"title is invalid"}`, res.Body, "Body must be correct")
+	})
+
+	t.Run("handler errors", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/missing",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+
+		res, err = lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/broken",
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode, "Status code must be 500")
+	})
+
+	t.Run("router error handler", func(t *testing.T) {
+		var handled []error
+		lmd.ErrorHandler = func(err error) (events.APIGatewayProxyResponse, error) {
+			handled = append(handled, err)
+			return HandleError(err)
+		}
+		defer func() { lmd.ErrorHandler = nil }()
+
+		res, _ := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/missing",
+		})
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+
+		res, _ = lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla/bla",
+		})
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "Status code must be 404")
+		assert.Equal(t, 2, len(handled), "Error handler must be called for both errors")
+	})
+
+	t.Run("router decoder options", func(t *testing.T) {
+		lmd.DecoderOptions.Strict = true
+		defer func() { lmd.DecoderOptions.Strict = false }()
+
+		res, _ := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/api/bla",
+			QueryStringParameters: map[string]string{
+				"unknown": "1",
+			},
+		})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "Status code must be 400")
+	})
+
+	t.Run("without router", func(t *testing.T) {
+		handler := Typed(func(ctx context.Context, input mockTypedInput) (string, error) {
+			return input.ID, nil
+		})
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{
+				"id": "bla",
+			},
+		})
+		assert.Equal(t, nil, err, "Error must be nil")
+		assert.Equal(t, `"bla"`, res.Body, "Body must be correct")
+	})
+}
@@ -0,0 +1,269 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// WebhookScheme describes how a webhook provider signs requests with HMAC.
+// Presets are provided for GitHub, Stripe and Slack, and GenericWebhook
+// creates schemes for other providers.
+type WebhookScheme struct {
+	// Header is the name of the header that contains the signature.
+	Header string
+
+	// TimestampHeader is the name of the header that contains the time the
+	// request was signed at, in seconds since the Unix epoch, if the
+	// provider sends it in a separate header.
+	TimestampHeader string
+
+	// Timestamped is true if signatures include a timestamp (either in the
+	// signature header or in TimestampHeader), which is checked against the
+	// tolerance of the middleware to reject replayed requests.
+	Timestamped bool
+
+	// Hash is the hash function used with HMAC.
+	Hash func() hash.Hash
+
+	// ParseHeader parses the value of the signature header into the
+	// timestamp it includes, if any, and the (decoded) signatures it
+	// includes. Providers may include multiple signatures, e.g. during
+	// secret rotation; a request is valid if any of them matches.
+	ParseHeader func(value string) (timestamp string, signatures [][]byte)
+
+	// SignedPayload generates the payload that is signed by the provider,
+	// from the timestamp and the raw request body.
+	SignedPayload func(timestamp string, body []byte) []byte
+}
+
+// GitHubWebhook verifies webhooks sent by GitHub, which are signed in the
+// "X-Hub-Signature-256" header. Since GitHub does not sign a timestamp,
+// replayed requests cannot be detected by the middleware; use the
+// "X-GitHub-Delivery" header to detect duplicate deliveries.
+var GitHubWebhook = WebhookScheme{
+	Header: "X-Hub-Signature-256",
+	Hash:   sha256.New,
+	ParseHeader: func(value string) (string, [][]byte) {
+		return "", hexSignatures(strings.TrimPrefix(value, "sha256="))
+	},
+	SignedPayload: func(_ string, body []byte) []byte {
+		return body
+	},
+}
+
+// StripeWebhook verifies webhooks sent by Stripe, which are signed in the
+// "Stripe-Signature" header along with a timestamp.
+var StripeWebhook = WebhookScheme{
+	Header:      "Stripe-Signature",
+	Timestamped: true,
+	Hash:        sha256.New,
+	ParseHeader: func(value string) (timestamp string, signatures [][]byte) {
+		for _, part := range strings.Split(value, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			switch kv[0] {
+			case "t":
+				timestamp = kv[1]
+			case "v1":
+				signatures = append(signatures, hexSignatures(kv[1])...)
+			}
+		}
+
+		return timestamp, signatures
+	},
+	SignedPayload: func(timestamp string, body []byte) []byte {
+		return append([]byte(timestamp+"."), body...)
+	},
+}
+
+// SlackWebhook verifies requests sent by Slack, which are signed in the
+// "X-Slack-Signature" header, with the timestamp in the
+// "X-Slack-Request-Timestamp" header.
+var SlackWebhook = WebhookScheme{
+	Header:          "X-Slack-Signature",
+	TimestampHeader: "X-Slack-Request-Timestamp",
+	Timestamped:     true,
+	Hash:            sha256.New,
+	ParseHeader: func(value string) (string, [][]byte) {
+		return "", hexSignatures(strings.TrimPrefix(value, "v0="))
+	},
+	SignedPayload: func(timestamp string, body []byte) []byte {
+		return append([]byte("v0:"+timestamp+":"), body...)
+	},
+}
+
+// GenericWebhook creates a scheme for providers that send a hex-encoded
+// HMAC-SHA256 signature in a header, optionally prefixed with "sha256=". If
+// timestampHeader is not empty, the provider is expected to send a Unix
+// timestamp in that header, and to sign the timestamp and the body joined with
+// a dot (e.g. "1700000000.{...}"). Otherwise, only the body is signed. Fields
+// of the returned scheme may be modified for providers that differ.
+func GenericWebhook(header, timestampHeader string) WebhookScheme {
+	return WebhookScheme{
+		Header:          header,
+		TimestampHeader: timestampHeader,
+		Timestamped:     timestampHeader != "",
+		Hash:            sha256.New,
+		ParseHeader: func(value string) (string, [][]byte) {
+			return "", hexSignatures(strings.TrimPrefix(value, "sha256="))
+		},
+		SignedPayload: func(timestamp string, body []byte) []byte {
+			if timestamp == "" {
+				return body
+			}
+			return append([]byte(timestamp+"."), body...)
+		},
+	}
+}
+
+func hexSignatures(value string) [][]byte {
+	signature, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil
+	}
+
+	return [][]byte{signature}
+}
+
+// WebhookOptions modify the behavior of WebhookMiddleware.
+type WebhookOptions struct {
+	// Scheme is the signature scheme of the webhook provider, e.g.
+	// StripeWebhook.
+	Scheme WebhookScheme
+
+	// Secret is the signing secret shared with the provider. It is required.
+	Secret []byte
+
+	// Tolerance is the maximum difference between the time a request was
+	// signed at and the current time, for timestamped schemes. Requests
+	// outside this window are rejected as replays. If zero, five minutes are
+	// used.
+	Tolerance time.Duration
+}
+
+// WebhookMiddleware returns a middleware that verifies the HMAC signatures of
+// webhook requests. Signatures are verified against the raw request body, as
+// sent by the provider (i.e. base-64 decoded if necessary, but before any
+// other decoding). For timestamped schemes, requests signed outside the
+// tolerance window are rejected, in order to prevent replay attacks. Requests
+// with missing or invalid signatures are rejected with a 401 Unauthorized
+// error response, generated by the router's error handler. The function
+// panics if the secret is empty (e.g. because an environment variable is not
+// set), since anyone could forge signatures with an empty key, or if the
+// scheme is incomplete.
+//
+// Example:
+//
+//     router.Route("POST", "/webhooks/stripe", handleStripeEvent, lmdrouter.WebhookMiddleware(
+//         lmdrouter.WebhookOptions{
+//             Scheme: lmdrouter.StripeWebhook,
+//             Secret: []byte(os.Getenv("STRIPE_WEBHOOK_SECRET")),
+//         },
+//     ))
+//
+func WebhookMiddleware(opts WebhookOptions) Middleware {
+	if len(opts.Secret) == 0 {
+		panic("Webhook middleware requires a non-empty secret")
+	}
+	scheme := opts.Scheme
+	if scheme.Header == "" || scheme.Hash == nil || scheme.ParseHeader == nil ||
+		scheme.SignedPayload == nil {
+		panic("Webhook middleware requires a complete signature scheme")
+	}
+
+	if opts.Tolerance == 0 {
+		opts.Tolerance = 5 * time.Minute
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			err := verifyWebhook(req, opts, time.Now())
+			if err != nil {
+				return routerFromContext(ctx).handleError(err)
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
+
+func verifyWebhook(
+	req events.APIGatewayProxyRequest,
+	opts WebhookOptions,
+	now time.Time,
+) error {
+	scheme := opts.Scheme
+
+	header := headerValue(req.Headers, scheme.Header)
+	if header == "" {
+		return invalidWebhookError("missing webhook signature")
+	}
+
+	timestamp, signatures := scheme.ParseHeader(header)
+	if scheme.TimestampHeader != "" {
+		timestamp = headerValue(req.Headers, scheme.TimestampHeader)
+	}
+
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return invalidWebhookError("invalid webhook body")
+		}
+	}
+
+	mac := hmac.New(scheme.Hash, opts.Secret)
+	mac.Write(scheme.SignedPayload(timestamp, body)) // nolint: errcheck
+	expected := mac.Sum(nil)
+
+	valid := false
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return invalidWebhookError("invalid webhook signature")
+	}
+
+	if !scheme.Timestamped {
+		return nil
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return invalidWebhookError("invalid webhook timestamp")
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > opts.Tolerance || age < -opts.Tolerance {
+		return invalidWebhookError("webhook timestamp outside of tolerance")
+	}
+
+	return nil
+}
+
+func invalidWebhookError(message string) error {
+	return HTTPError{
+		Code:    http.StatusUnauthorized,
+		Message: message,
+	}
+}
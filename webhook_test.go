@@ -0,0 +1,171 @@
+package lmdrouter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+)
+
+func TestWebhookMiddleware(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := `{"type":"payment_intent.succeeded"}`
+
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+
+	lmd := NewRouter("/webhooks")
+	lmd.Route("POST", "/github", postWebhook, WebhookMiddleware(WebhookOptions{Scheme: GitHubWebhook, Secret: secret}))
+	lmd.Route("POST", "/stripe", postWebhook, WebhookMiddleware(WebhookOptions{Scheme: StripeWebhook, Secret: secret}))
+	lmd.Route("POST", "/slack", postWebhook, WebhookMiddleware(WebhookOptions{Scheme: SlackWebhook, Secret: secret}))
+	lmd.Route("POST", "/generic", postWebhook, WebhookMiddleware(WebhookOptions{
+		Scheme:    GenericWebhook("X-Signature", "X-Timestamp"),
+		Secret:    secret,
+		Tolerance: time.Hour,
+	}))
+
+	for name, test := range map[string]struct {
+		path    string
+		headers map[string]string
+		base64  bool
+		status  int
+	}{
+		"github": {
+			"/webhooks/github",
+			map[string]string{"x-hub-signature-256": "sha256=" + sign(body)},
+			false,
+			http.StatusOK,
+		},
+		"github, base-64 encoded body": {
+			"/webhooks/github",
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sign(body)},
+			true,
+			http.StatusOK,
+		},
+		"github, invalid signature": {
+			"/webhooks/github",
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sign(body+" ")},
+			false,
+			http.StatusUnauthorized,
+		},
+		"github, missing signature": {
+			"/webhooks/github",
+			nil,
+			false,
+			http.StatusUnauthorized,
+		},
+		"stripe, rotated secrets": {
+			"/webhooks/stripe",
+			map[string]string{"Stripe-Signature": "t=" + now + ",v1=" + sign("bla") + ",v1=" + sign(now+"."+body)},
+			false,
+			http.StatusOK,
+		},
+		"stripe, tampered timestamp": {
+			"/webhooks/stripe",
+			map[string]string{"Stripe-Signature": "t=" + now + ",v1=" + sign(old+"."+body)},
+			false,
+			http.StatusUnauthorized,
+		},
+		"stripe, replay": {
+			"/webhooks/stripe",
+			map[string]string{"Stripe-Signature": "t=" + old + ",v1=" + sign(old+"."+body)},
+			false,
+			http.StatusUnauthorized,
+		},
+		"stripe, missing timestamp": {
+			"/webhooks/stripe",
+			map[string]string{"Stripe-Signature": "v1=" + sign("."+body)},
+			false,
+			http.StatusUnauthorized,
+		},
+		"slack": {
+			"/webhooks/slack",
+			map[string]string{
+				"X-Slack-Signature":         "v0=" + sign("v0:"+now+":"+body),
+				"X-Slack-Request-Timestamp": now,
+			},
+			false,
+			http.StatusOK,
+		},
+		"slack, replay": {
+			"/webhooks/slack",
+			map[string]string{
+				"X-Slack-Signature":         "v0=" + sign("v0:"+old+":"+body),
+				"X-Slack-Request-Timestamp": old,
+			},
+			false,
+			http.StatusUnauthorized,
+		},
+		"generic, within tolerance": {
+			"/webhooks/generic",
+			map[string]string{
+				"X-Signature": sign(old + "." + body),
+				"X-Timestamp": old,
+			},
+			false,
+			http.StatusOK,
+		},
+	} {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: "POST",
+			Path:       test.path,
+			Headers:    test.headers,
+			Body:       body,
+		}
+		if test.base64 {
+			req.Body = base64.StdEncoding.EncodeToString([]byte(body))
+			req.IsBase64Encoded = true
+		}
+
+		res, err := lmd.Handler(context.Background(), req)
+		assert.Equal(t, nil, err, "Error must be nil for "+name)
+		assert.Equal(t, test.status, res.StatusCode, "Status code must be correct for "+name)
+		if test.status == http.StatusOK {
+			assert.Equal(t, `{"type":"payment_intent.succeeded"}`, res.Body, "Body must be decoded for "+name)
+		}
+	}
+}
+
+func TestWebhookMiddlewareInvalidOptions(t *testing.T) {
+	for name, opts := range map[string]WebhookOptions{
+		"nil secret":   {Scheme: GitHubWebhook},
+		"empty secret": {Scheme: StripeWebhook, Secret: []byte("")},
+		"empty scheme": {Secret: []byte("s3cr3t")},
+	} {
+		func() {
+			defer func() {
+				assert.NotEqual(t, nil, recover(), "Middleware creation must panic for "+name)
+			}()
+			WebhookMiddleware(opts)
+		}()
+	}
+}
+
+func postWebhook(_ context.Context, req events.APIGatewayProxyRequest) (
+	events.APIGatewayProxyResponse,
+	error,
+) {
+	var input struct {
+		Type string `json:"type"`
+	}
+	err := UnmarshalRequest(req, true, &input)
+	if err != nil {
+		return HandleError(err)
+	}
+
+	return MarshalResponse(http.StatusOK, nil, input)
+}